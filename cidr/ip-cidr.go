@@ -78,6 +78,15 @@ func MarshalText(wrappers []IRange, outputType OutputType) []IRange {
 		for _, r := range wrappers {
 			result = append(result, r.ToRange())
 		}
+	} else if outputType == OutputTypeSum {
+		// a range is kept only if it can't be represented as a single cidr
+		for _, r := range wrappers {
+			if ipNets := r.ToIpNets(); len(ipNets) == 1 {
+				result = append(result, IpNetWrapper{ipNets[0]})
+			} else {
+				result = append(result, r.ToRange())
+			}
+		}
 	} else {
 		for _, r := range wrappers {
 			for _, ipNet := range r.ToIpNets() {
@@ -0,0 +1,82 @@
+// set algebra over the codes of -list, e.g. "geolocation-!cn,-category-ads,&google"
+package codeset
+
+import (
+	"fmt"
+	"strings"
+)
+
+type Op int
+
+const (
+	Union     Op = iota // "code", add the code to the result
+	Exclude             // "-code", remove the code from the result
+	Intersect           // "&code", keep only what is also in the code
+)
+
+type Term struct {
+	Op   Op
+	Code string
+}
+
+// Expr is evaluated from left to right, starting from an empty set
+type Expr []Term
+
+// parse a comma separated code list, "&" can also be used inline, such as "cn&cloudflare".
+// codes are kept as is, "-" is an operator only at the beginning of a code.
+// operators have no precedence, "cn,-google&ads" is ((cn - google) & ads) rather
+// than (cn - (google & ads))
+func Parse(s string) (Expr, error) {
+	var expr Expr
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue // tolerate empty items such as "cn,,jp"
+		}
+		op := Union
+		if strings.HasPrefix(part, "-") {
+			op = Exclude
+			part = part[1:]
+		} else if strings.HasPrefix(part, "&") {
+			op = Intersect
+			part = part[1:]
+		}
+		for i, code := range strings.Split(part, "&") {
+			if i > 0 {
+				op = Intersect
+			}
+			code = strings.TrimSpace(code)
+			if code == "" {
+				return nil, fmt.Errorf("missing code in %q", s)
+			}
+			if len(expr) == 0 && op != Union {
+				return nil, fmt.Errorf("expression must start with a code to add, got %q", s)
+			}
+			expr = append(expr, Term{Op: op, Code: code})
+		}
+	}
+	return expr, nil
+}
+
+// all codes referenced by the expression, duplicates removed
+func (e Expr) Codes() []string {
+	seen := make(map[string]bool)
+	var list []string
+	for _, term := range e {
+		if !seen[term.Code] {
+			seen[term.Code] = true
+			list = append(list, term.Code)
+		}
+	}
+	return list
+}
+
+// a plain expression is a union of codes, which is what -list used to be
+func (e Expr) Plain() bool {
+	for _, term := range e {
+		if term.Op != Union {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,60 @@
+package codeset
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		input string
+		want  Expr // nil if an error is expected
+	}{
+		{"cn", Expr{{Union, "cn"}}},
+		{"cn,jp", Expr{{Union, "cn"}, {Union, "jp"}}},
+		{" cn , ,jp,", Expr{{Union, "cn"}, {Union, "jp"}}},
+		{"cn,-private", Expr{{Union, "cn"}, {Exclude, "private"}}},
+		{"cn,&cloudflare", Expr{{Union, "cn"}, {Intersect, "cloudflare"}}},
+		{"cn&cloudflare", Expr{{Union, "cn"}, {Intersect, "cloudflare"}}},
+		{"cn,-google&ads", Expr{{Union, "cn"}, {Exclude, "google"}, {Intersect, "ads"}}},
+		{"geolocation-!cn,-category-ads,&google", Expr{{Union, "geolocation-!cn"}, {Exclude, "category-ads"}, {Intersect, "google"}}},
+		{"apple@cn,-apple@ads", Expr{{Union, "apple@cn"}, {Exclude, "apple@ads"}}},
+		{"-cn", nil},
+		{"&cn", nil},
+		{"cn,-", nil},
+		{"cn&", nil},
+		{"cn&&jp", nil},
+	}
+	for _, tt := range tests {
+		expr, err := Parse(tt.input)
+		if tt.want == nil {
+			if err == nil {
+				t.Errorf("%q: expected an error, got %v", tt.input, expr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", tt.input, err)
+			continue
+		}
+		if !reflect.DeepEqual(expr, tt.want) {
+			t.Errorf("%q: expected %v, got %v", tt.input, tt.want, expr)
+		}
+	}
+}
+
+func TestExprCodes(t *testing.T) {
+	expr, err := Parse("cn,jp,-cn,&us")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if codes := expr.Codes(); !reflect.DeepEqual(codes, []string{"cn", "jp", "us"}) {
+		t.Errorf("expected codes cn,jp,us, got %v", codes)
+	}
+	if expr.Plain() {
+		t.Error("expression with operators is not plain")
+	}
+	if expr, _ := Parse("cn,jp"); !expr.Plain() {
+		t.Error("union of codes is plain")
+	}
+}
@@ -0,0 +1,142 @@
+package geoip
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// BuildGeoIP compiles a directory of CODE.txt files with one ip or cidr per line,
+// or a csv file of "cidr,code" records, into a GeoIPList. The csv databases of
+// GeoLite2-Country (a directory), IP2Location LITE DB1 and DB-IP country lite
+// are imported as well
+func BuildGeoIP(path string) (*GeoIPList, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	entries := make(map[string]*Entry)
+	if info.IsDir() && isMaxMindCSV(path) {
+		err = importMaxMind(path, entries)
+	} else if info.IsDir() {
+		err = buildFromDir(path, entries)
+	} else {
+		err = buildFromCSV(path, entries)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return EntriesToGeoIP(entries)
+}
+
+func buildFromDir(dir string, entries map[string]*Entry) error {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if file.IsDir() || !strings.EqualFold(filepath.Ext(file.Name()), ".txt") {
+			continue
+		}
+		entry := NewEntry(strings.TrimSuffix(file.Name(), filepath.Ext(file.Name())))
+		if err := entry.addFromFile(filepath.Join(dir, file.Name())); err != nil {
+			return err
+		}
+		if _, ok := entries[entry.GetName()]; ok {
+			return fmt.Errorf("%s is defined more than once", entry.GetName())
+		}
+		entries[entry.GetName()] = entry
+	}
+	return nil
+}
+
+func (e *Entry) addFromFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		if err := e.AddPrefix(scanner.Text()); err != nil {
+			return fmt.Errorf("%s:%d: %w", path, lineNo, err)
+		}
+	}
+	return scanner.Err()
+}
+
+func buildFromCSV(path string, entries map[string]*Entry) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	reader := csv.NewReader(file)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	for first := true; ; first = false {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		line, _ := reader.FieldPos(0)
+		r, code, err := parseRecord(record)
+		if err == errNoCode {
+			continue
+		}
+		if err == ErrInvalidIP && first {
+			continue // header
+		}
+		if err != nil {
+			return fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		entry, ok := entries[code]
+		if !ok {
+			entry = NewEntry(code)
+			entries[code] = entry
+		}
+		if err := entry.addRange(r); err != nil {
+			return fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+	}
+}
+
+// EntriesToGeoIP converts entries into a GeoIPList sorted by code, entries
+// without any prefix are skipped
+func EntriesToGeoIP(entries map[string]*Entry) (*GeoIPList, error) {
+	ipList := new(GeoIPList)
+	for _, entry := range entries {
+		prefixes, err := entry.MarshalPrefix()
+		if errors.Is(err, ErrEmptyEntry) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		geoip := &GeoIP{
+			CountryCode: entry.GetName(),
+		}
+		for _, prefix := range prefixes {
+			geoip.Cidr = append(geoip.Cidr, &CIDR{
+				Ip:     prefix.Addr().AsSlice(),
+				Prefix: uint32(prefix.Bits()),
+			})
+		}
+		ipList.Entry = append(ipList.Entry, geoip)
+	}
+	// Sort protoList so the marshaled list is reproducible
+	sort.SliceStable(ipList.Entry, func(i, j int) bool {
+		return ipList.Entry[i].CountryCode < ipList.Entry[j].CountryCode
+	})
+	return ipList, nil
+}
@@ -3,13 +3,16 @@ package geoip
 import (
 	"errors"
 	"fmt"
-	"github.com/snowie2000/geoview/global"
 	"io"
 	"net"
 	"net/netip"
 	"os"
+	"sort"
 	"strconv"
+	"strings"
 
+	"github.com/snowie2000/geoview/cidr"
+	"github.com/snowie2000/geoview/codeset"
 	"github.com/snowie2000/geoview/protohelper"
 	"github.com/snowie2000/geoview/srs"
 	"go4.org/netipx"
@@ -20,8 +23,37 @@ type GeoIPDatIn struct {
 	URI       string
 	Want      map[string]bool
 	MustExist bool
+	// set operations over the wanted codes, a plain union of Want if empty
+	Expression codeset.Expr
+	// merge overlapping and adjacent prefixes of the result
+	Merge bool
+	// output the complement of the result, or flip reverse_match for database output
+	Invert bool
+	// Reader is read instead of the file of URI if set, Size is its length
+	Reader io.ReaderAt
+	Size   int64
+	// read codes one by one instead of loading the whole file
+	Lowmem bool
 }
 
+// open the database file, or the reader if set
+func (g *GeoIPDatIn) open() (io.ReadSeekCloser, error) {
+	if g.Reader != nil {
+		return &protohelper.NopReadSeekCloser{ReadSeeker: io.NewSectionReader(g.Reader, 0, g.Size)}, nil
+	}
+	return os.Open(g.URI)
+}
+
+// load the database as sing-box geoip or maxmind database
+func (g *GeoIPDatIn) loadMMDB() (*MMDB, error) {
+	if g.Reader != nil {
+		return LoadMMDBFromReader(g.Reader, g.Size)
+	}
+	return LoadMMDB(g.URI)
+}
+
+var errExpression = errors.New("set operators are not supported by database output")
+
 type IPType int
 
 const (
@@ -30,7 +62,30 @@ const (
 )
 
 func (g *GeoIPDatIn) ToGeoIP() (*GeoIPList, error) {
-	reader, err := os.Open(g.URI)
+	if !g.Expression.Plain() {
+		return nil, errExpression
+	}
+	ipList, err := g.toGeoIP()
+	if err != nil {
+		return nil, err
+	}
+	if g.Invert {
+		// xray matches everything but the cidr of reverse match entries
+		for _, entry := range ipList.Entry {
+			entry.ReverseMatch = !entry.ReverseMatch
+		}
+	}
+	return ipList, nil
+}
+
+func (g *GeoIPDatIn) toGeoIP() (*GeoIPList, error) {
+	// try sing-box geoip or maxmind database
+	if db, err := g.loadMMDB(); err == nil {
+		defer db.Close()
+		return g.mmdbToGeoIP(db)
+	}
+
+	reader, err := g.open()
 	if err != nil {
 		return nil, err
 	}
@@ -60,14 +115,48 @@ func (g *GeoIPDatIn) ToGeoIP() (*GeoIPList, error) {
 	return ipList, nil
 }
 
+// list all codes of the database
+func (g *GeoIPDatIn) Codes() ([]string, error) {
+	if db, err := g.loadMMDB(); err == nil {
+		defer db.Close()
+		codes, err := db.Codes()
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(codes)
+		return codes, nil
+	}
+
+	reader, err := g.open()
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	var codes []string
+	for _, code := range protohelper.CodeListByReader(reader) {
+		codes = append(codes, code.Name)
+	}
+	sort.Strings(codes)
+	return codes, nil
+}
+
 func (g *GeoIPDatIn) FindIP(ip string) (list []string) {
 	nip, ok := netipx.FromStdIP(net.ParseIP(ip))
 	if !ok {
 		return
 	}
 
+	// try sing-box geoip or maxmind database
+	if db, err := g.loadMMDB(); err == nil {
+		defer db.Close()
+		if code, err := db.Lookup(nip.AsSlice()); err == nil && code != "" {
+			list = append(list, code)
+		}
+		return
+	}
+
 	// read from url or file
-	file, err := os.Open(g.URI)
+	file, err := g.open()
 	if err != nil {
 		return
 	}
@@ -84,17 +173,22 @@ func (g *GeoIPDatIn) FindIP(ip string) (list []string) {
 		io.ReadFull(file, stripped)
 		if stripped != nil {
 			proto.Unmarshal(stripped, &geoip)
+			found := false
 			for _, v2rayCIDR := range geoip.Cidr {
 				vip := net.IP(v2rayCIDR.GetIp())
 				if is4 := vip.To4() != nil; is4 == nip.Is4() {
 					ipStr := vip.String() + "/" + fmt.Sprint(v2rayCIDR.GetPrefix())
 					prefix, _ = netip.ParsePrefix(ipStr)
 					if prefix.Contains(nip) {
-						list = append(list, code.Name)
+						found = true
 						break
 					}
 				}
 			}
+			// reverse match entries contain everything but their cidr
+			if found != geoip.ReverseMatch {
+				list = append(list, code.Name)
+			}
 		} else {
 			// log.Println("code not found", code)
 		}
@@ -104,7 +198,7 @@ func (g *GeoIPDatIn) FindIP(ip string) (list []string) {
 
 func (g *GeoIPDatIn) Extract(ipType IPType) (list []string, err error) {
 	//log.Println("extracting", ipType)
-	err, list = g.parseFile(g.URI, ipType)
+	err, list = g.parseFile(ipType)
 	//log.Println("file read")
 
 	if err != nil {
@@ -138,51 +232,95 @@ func (g *GeoIPDatIn) ToRuleSet(ipType IPType) (*srs.PlainRuleSetCompat, error) {
 	return ruleset, nil
 }
 
-func (g *GeoIPDatIn) ToQuantumultX(ipType IPType) ([]string, error) {
-	// extract ip rules from the database
-	var list4 []string
-	var list6 []string
-	err, list := g.parseFile(g.URI, IPv4)
-	if err == nil {
-		list4 = make([]string, len(list))
-		// now convert ip-cidr into qx filter format
+// convert ip-cidr into clash rule-provider payload of the given behavior
+func CIDRToClashRule(list []string, behavior string) ([]string, error) {
+	switch behavior {
+	case "classical":
+		rules := make([]string, len(list))
 		for i, cidr := range list {
-			list4[i] = fmt.Sprintf("ip-cidr, %s, Proxy", cidr)
+			if strings.Contains(cidr, ":") {
+				rules[i] = "IP-CIDR6," + cidr
+			} else {
+				rules[i] = "IP-CIDR," + cidr
+			}
 		}
+		return rules, nil
+	case "ipcidr":
+		return list, nil
+	case "domain":
+		// no ip rules in domain providers
+		return []string{}, nil
 	}
+	return nil, fmt.Errorf("unknown clash behavior: %s", behavior)
+}
 
-	err, list = g.parseFile(g.URI, IPv6)
-	if err == nil {
-		list6 = make([]string, len(list))
-		// now convert ip-cidr into qx filter format
-		for i, cidr := range list {
-			list6[i] = fmt.Sprintf("ip6-cidr, %s, Proxy", cidr)
+// render ip-cidr in the given output type, ranges are sorted and merged first
+func CIDRToRange(list []string, outputType cidr.OutputType) ([]string, error) {
+	ranges := make([]cidr.IRange, 0, len(list))
+	for _, v := range list {
+		r, err := cidr.ParseRange(v)
+		if err != nil {
+			return nil, err
 		}
+		ranges = append(ranges, r)
 	}
+	ranges = cidr.MarshalText(cidr.SortAndMerge(ranges), outputType)
+	rules := make([]string, len(ranges))
+	for i, r := range ranges {
+		rules[i] = r.String()
+	}
+	return rules, nil
+}
 
-	var ignoreIPType IPIgnoreType = ""
-	if ipType&IPv4 == 0 {
-		ignoreIPType = IgIPv4
+// build a v2ray GeoIP entry from a list of ip-cidr or single ip strings
+func CIDRToGeoIP(code string, list []string) (*GeoIP, error) {
+	geoip := &GeoIP{
+		CountryCode: strings.ToUpper(code),
 	}
-	if ipType&IPv6 == 0 {
-		ignoreIPType = IgIPv6
+	for _, v := range list {
+		prefix, err := netip.ParsePrefix(v)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(v)
+			if addrErr != nil {
+				return nil, err
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		geoip.Cidr = append(geoip.Cidr, &CIDR{
+			Ip:     prefix.Addr().Unmap().AsSlice(),
+			Prefix: uint32(prefix.Bits()),
+		})
 	}
-	// return request lists
-	switch ignoreIPType {
-	case IgIPv4:
-		// only output ipv6 results
-		return list6, nil
-	case IgIPv6:
-		// only output ipv4 results;
-		return list4, nil
-	default:
-		// output both
-		return append(list4, list6...), nil
+	return geoip, nil
+}
+
+func (g *GeoIPDatIn) parseFile(iptype IPType) (error, []string) {
+	var (
+		err  error
+		list []string
+	)
+	if !g.Expression.Plain() {
+		err, list = g.evaluate(iptype)
+	} else {
+		err, list = g.readFile(iptype)
+	}
+	if err == nil && g.Merge {
+		err, list = mergeCIDR(NewEntry("merged"), list)
 	}
+	if err == nil && g.Invert {
+		return invertCIDR(list, iptype)
+	}
+	return err, list
 }
 
-func (g *GeoIPDatIn) parseFile(path string, iptype IPType) (error, []string) {
-	file, err := os.Open(path)
+func (g *GeoIPDatIn) readFile(iptype IPType) (error, []string) {
+	// try sing-box geoip or maxmind database
+	if db, err := g.loadMMDB(); err == nil {
+		defer db.Close()
+		return g.generateEntriesFromMMDB(db, iptype)
+	}
+
+	file, err := g.open()
 	if err != nil {
 		return err, nil
 	}
@@ -191,8 +329,105 @@ func (g *GeoIPDatIn) parseFile(path string, iptype IPType) (error, []string) {
 	return g.generateEntries(file, iptype)
 }
 
+// evaluate the code expression with ip set maths, each code is read on its own
+func (g *GeoIPDatIn) evaluate(iptype IPType) (error, []string) {
+	result := NewEntry("result")
+	for _, term := range g.Expression {
+		code := strings.ToUpper(term.Code)
+		sub := &GeoIPDatIn{
+			URI:       g.URI,
+			Want:      map[string]bool{code: true},
+			MustExist: g.MustExist,
+			Reader:    g.Reader,
+			Size:      g.Size,
+			Lowmem:    g.Lowmem,
+		}
+		err, list := sub.parseFile(iptype)
+		if err != nil {
+			return err, nil
+		}
+		switch term.Op {
+		case codeset.Union:
+			for _, cidr := range list {
+				if err := result.AddPrefix(cidr); err != nil {
+					return err, nil
+				}
+			}
+		case codeset.Exclude:
+			for _, cidr := range list {
+				if err := result.RemovePrefix(cidr); err != nil {
+					return err, nil
+				}
+			}
+		case codeset.Intersect:
+			entry := NewEntry(code)
+			for _, cidr := range list {
+				if err := entry.AddPrefix(cidr); err != nil {
+					return err, nil
+				}
+			}
+			if err := result.Intersect(entry); err != nil {
+				return err, nil
+			}
+		}
+	}
+	return mergeCIDR(result, nil)
+}
+
+// the complement of the list within the ip space of iptype
+func invertCIDR(list []string, iptype IPType) (error, []string) {
+	entry := NewEntry("inverted")
+	if iptype&IPv4 != 0 {
+		entry.AddPrefix("0.0.0.0/0")
+	}
+	if iptype&IPv6 != 0 {
+		entry.AddPrefix("::/0")
+	}
+	for _, cidr := range list {
+		if err := entry.RemovePrefix(cidr); err != nil {
+			return err, nil
+		}
+	}
+	return mergeCIDR(entry, nil)
+}
+
+// ip-cidr of a GeoIP entry, reverse match entries are inverted
+func geoipToCIDR(geoip *GeoIP, iptype IPType) (error, []string) {
+	allowIPv4 := iptype&IPv4 != 0
+	allowIPv6 := iptype&IPv6 != 0
+	var list []string
+	for _, v2rayCIDR := range geoip.Cidr {
+		ip := net.IP(v2rayCIDR.GetIp())
+		if ip.To4() != nil {
+			if allowIPv4 {
+				list = append(list, ip.String()+"/"+strconv.Itoa(int(v2rayCIDR.GetPrefix())))
+			}
+		} else if allowIPv6 {
+			list = append(list, ip.String()+"/"+strconv.Itoa(int(v2rayCIDR.GetPrefix())))
+		}
+	}
+	if geoip.ReverseMatch {
+		return invertCIDR(list, iptype)
+	}
+	return nil, list
+}
+
+// add the list to the entry and output the merged prefixes of the entry
+func mergeCIDR(entry *Entry, list []string) (error, []string) {
+	for _, cidr := range list {
+		if err := entry.AddPrefix(cidr); err != nil {
+			return err, nil
+		}
+	}
+	merged, err := entry.MarshalText()
+	if errors.Is(err, ErrEmptyEntry) {
+		return nil, nil
+	}
+	return err, merged
+}
+
 func (g *GeoIPDatIn) generateEntries(reader io.ReadSeeker, iptype IPType) (error, []string) {
-	if global.Lowmem {
+	if g.Lowmem {
 		return g.generateEntriesFromFile(reader, iptype)
 	}
 
@@ -200,26 +435,18 @@ func (g *GeoIPDatIn) generateEntries(reader io.ReadSeeker, iptype IPType) (error
 	if err != nil {
 		return err, nil
 	}
-	allowIPv4 := iptype&IPv4 != 0
-	allowIPv6 := iptype&IPv6 != 0
-	var (
-		ip   net.IP
-		list []string = nil
-	)
+	var list []string = nil
 	for code := range g.Want {
 		var geoip GeoIP
 		stripped := protohelper.FindCode(geoipBytes, []byte(code))
 		if stripped != nil {
 			proto.Unmarshal(stripped, &geoip)
 
-			for _, v2rayCIDR := range geoip.Cidr {
-				ip = net.IP(v2rayCIDR.GetIp())
-				if ip.To4() != nil && allowIPv4 {
-					list = append(list, ip.String()+"/"+strconv.Itoa(int(v2rayCIDR.GetPrefix())))
-				} else if allowIPv6 {
-					list = append(list, ip.String()+"/"+strconv.Itoa(int(v2rayCIDR.GetPrefix())))
-				}
+			err, cidrList := geoipToCIDR(&geoip, iptype)
+			if err != nil {
+				return err, nil
 			}
+			list = append(list, cidrList...)
 		} else if g.MustExist {
 			return fmt.Errorf("%s doesn't exist", code), nil
 		}
@@ -231,12 +458,7 @@ func (g *GeoIPDatIn) generateEntries(reader io.ReadSeeker, iptype IPType) (error
 func (g *GeoIPDatIn) generateEntriesFromFile(reader io.ReadSeeker, iptype IPType) (error, []string) {
 	reader.Seek(0, io.SeekStart)
 	codeList := protohelper.CodeListByReader(reader)
-	allowIPv4 := iptype&IPv4 != 0
-	allowIPv6 := iptype&IPv6 != 0
-	var (
-		ip   net.IP
-		list []string = nil
-	)
+	var list []string = nil
 	for _, code := range codeList {
 		if _, ok := g.Want[code.Name]; ok {
 			reader.Seek(code.Offset, io.SeekStart)
@@ -250,21 +472,46 @@ func (g *GeoIPDatIn) generateEntriesFromFile(reader io.ReadSeeker, iptype IPType
 				}
 				//log.Println("protobuf ready")
 
-				for _, v2rayCIDR := range geoip.Cidr {
-					ip = net.IP(v2rayCIDR.GetIp())
-					if ip.To4() != nil {
-						if allowIPv4 {
-							list = append(list, ip.String()+"/"+strconv.Itoa(int(v2rayCIDR.GetPrefix())))
-						}
-					} else if allowIPv6 {
-						list = append(list, ip.String()+"/"+strconv.Itoa(int(v2rayCIDR.GetPrefix())))
-					}
+				err, cidrList := geoipToCIDR(&geoip, iptype)
+				if err != nil {
+					return err, nil
 				}
+				list = append(list, cidrList...)
 			} else if g.MustExist {
-				return fmt.Errorf("%s doesn't exist", code), nil
+				return fmt.Errorf("%s doesn't exist", code.Name), nil
 			}
 			//runtime.GC()
 		}
 	}
 	return nil, list
 }
+
+// report whether the file is a geoip database, either a mmdb or a v2ray dat
+// whose entries hold ip addresses
+func IsGeoIP(path string) bool {
+	if db, err := LoadMMDB(path); err == nil {
+		db.Close()
+		return true
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+	for _, code := range protohelper.CodeListByReader(file) {
+		stripped, err := protohelper.ReadEntry(file, code)
+		if err != nil {
+			return false
+		}
+		var geoip GeoIP
+		if err := proto.Unmarshal(stripped, &geoip); err != nil {
+			return false
+		}
+		// domains of a geosite.dat are parsed into cidr without ip
+		if len(geoip.Cidr) > 0 {
+			ip := geoip.Cidr[0].GetIp()
+			return len(ip) == net.IPv4len || len(ip) == net.IPv6len
+		}
+	}
+	return false
+}
@@ -39,6 +39,7 @@ var (
 	ErrInvalidPrefix       = errors.New("invalid prefix")
 	ErrInvalidPrefixType   = errors.New("invalid prefix type")
 	ErrCommentLine         = errors.New("comment line")
+	ErrEmptyEntry          = errors.New("no prefix")
 )
 
 type Entry struct {
@@ -316,7 +317,10 @@ func (e *Entry) remove(prefix *netip.Prefix, ipType IPIgnoreType) error {
 
 func (e *Entry) AddPrefix(cidr any) error {
 	prefix, ipType, err := e.processPrefix(cidr)
-	if err != nil && err != ErrCommentLine {
+	if err == ErrCommentLine {
+		return nil
+	}
+	if err != nil {
 		return err
 	}
 	if err := e.add(prefix, ipType); err != nil {
@@ -327,7 +331,10 @@ func (e *Entry) AddPrefix(cidr any) error {
 
 func (e *Entry) RemovePrefix(cidr string) error {
 	prefix, ipType, err := e.processPrefix(cidr)
-	if err != nil && err != ErrCommentLine {
+	if err == ErrCommentLine {
+		return nil
+	}
+	if err != nil {
 		return err
 	}
 	if err := e.remove(prefix, ipType); err != nil {
@@ -336,6 +343,28 @@ func (e *Entry) RemovePrefix(cidr string) error {
 	return nil
 }
 
+// keep only the prefixes also covered by another entry
+func (e *Entry) Intersect(other *Entry) error {
+	if err := other.buildIPSet(); err != nil {
+		return err
+	}
+	if e.hasIPv4Builder() {
+		if other.hasIPv4Set() {
+			e.IPv4Builder.Intersect(other.IPv4Set)
+		} else {
+			e.IPv4Builder = nil
+		}
+	}
+	if e.hasIPv6Builder() {
+		if other.hasIPv6Set() {
+			e.IPv6Builder.Intersect(other.IPv6Set)
+		} else {
+			e.IPv6Builder = nil
+		}
+	}
+	return nil
+}
+
 func (e *Entry) buildIPSet() error {
 	if e.hasIPv4Builder() && !e.hasIPv4Set() {
 		IPv4set, err := e.IPv4Builder.IPSet()
@@ -389,7 +418,7 @@ func (e *Entry) MarshalPrefix(opts ...IgnoreIPOption) ([]netip.Prefix, error) {
 		return prefixes, nil
 	}
 
-	return nil, fmt.Errorf("entry %s has no prefix", e.GetName())
+	return nil, fmt.Errorf("entry %s has %w", e.GetName(), ErrEmptyEntry)
 }
 
 func (e *Entry) MarshalIPRange(opts ...IgnoreIPOption) ([]netipx.IPRange, error) {
@@ -425,7 +454,7 @@ func (e *Entry) MarshalIPRange(opts ...IgnoreIPOption) ([]netipx.IPRange, error)
 		return ipranges, nil
 	}
 
-	return nil, fmt.Errorf("entry %s has no prefix", e.GetName())
+	return nil, fmt.Errorf("entry %s has %w", e.GetName(), ErrEmptyEntry)
 }
 
 func (e *Entry) MarshalText(opts ...IgnoreIPOption) ([]string, error) {
@@ -465,5 +494,5 @@ func (e *Entry) MarshalText(opts ...IgnoreIPOption) ([]string, error) {
 		return cidrList, nil
 	}
 
-	return nil, fmt.Errorf("entry %s has no prefix", e.GetName())
+	return nil, fmt.Errorf("entry %s has %w", e.GetName(), ErrEmptyEntry)
 }
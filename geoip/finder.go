@@ -0,0 +1,241 @@
+package geoip
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"sort"
+
+	"github.com/snowie2000/geoview/protohelper"
+	"go4.org/netipx"
+	"google.golang.org/protobuf/proto"
+)
+
+// Finder keeps the ip sets of every code, so that a batch of ips can be looked
+// up without reading the file again
+type Finder struct {
+	db       *MMDB
+	codes    []string
+	sets     []*netipx.IPSet
+	prefixes [][]netip.Prefix // cidr as stored in the file, for explanation
+	reverse  []bool
+}
+
+// Match is a rule which matched the lookup target
+type Match struct {
+	Code string
+	Rule string
+}
+
+// load all codes of the geoip file, mmdb databases are kept open until Close
+func (g *GeoIPDatIn) NewFinder() (*Finder, error) {
+	// try sing-box geoip or maxmind database
+	if db, err := g.loadMMDB(); err == nil {
+		return &Finder{db: db}, nil
+	}
+
+	file, err := g.open()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	f := new(Finder)
+	codeList := protohelper.CodeListByReader(file) // get all available geoip codes
+	codes := make([]string, 0, len(codeList))
+	for code := range codeList {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	for _, code := range codes {
+		index := codeList[code]
+		file.Seek(index.Offset, io.SeekStart)
+		stripped := make([]byte, index.Size)
+		if _, err := io.ReadFull(file, stripped); err != nil {
+			return nil, err
+		}
+		var geoip GeoIP
+		if err := proto.Unmarshal(stripped, &geoip); err != nil {
+			return nil, err
+		}
+		var builder netipx.IPSetBuilder
+		prefixes := make([]netip.Prefix, 0, len(geoip.Cidr))
+		for _, v2rayCIDR := range geoip.Cidr {
+			addr, ok := netip.AddrFromSlice(v2rayCIDR.GetIp())
+			if !ok {
+				return nil, ErrInvalidIP
+			}
+			prefix := netip.PrefixFrom(addr.Unmap(), int(v2rayCIDR.GetPrefix()))
+			builder.AddPrefix(prefix)
+			prefixes = append(prefixes, prefix)
+		}
+		// reverse match entries contain everything but their cidr
+		if geoip.ReverseMatch {
+			builder.Complement()
+		}
+		set, err := builder.IPSet()
+		if err != nil {
+			return nil, err
+		}
+		f.codes = append(f.codes, code)
+		f.sets = append(f.sets, set)
+		f.prefixes = append(f.prefixes, prefixes)
+		f.reverse = append(f.reverse, geoip.ReverseMatch)
+	}
+	return f, nil
+}
+
+func (f *Finder) Close() error {
+	if f.db != nil {
+		return f.db.Close()
+	}
+	return nil
+}
+
+// return the codes containing the ip, nil for invalid ips
+func (f *Finder) Find(ip string) []string {
+	nip, ok := netipx.FromStdIP(net.ParseIP(ip))
+	if !ok {
+		return nil
+	}
+	list := []string{}
+	if f.db != nil {
+		if code, err := f.db.Lookup(nip.AsSlice()); err == nil && code != "" {
+			list = append(list, code)
+		}
+		return list
+	}
+	for i, set := range f.sets {
+		if set.Contains(nip) {
+			list = append(list, f.codes[i])
+		}
+	}
+	return list
+}
+
+// return the cidr containing the ip of each matched code
+func (f *Finder) Explain(ip string) []Match {
+	nip, ok := netipx.FromStdIP(net.ParseIP(ip))
+	if !ok {
+		return nil
+	}
+	list := []Match{}
+	if f.db != nil {
+		if code, network, err := f.db.LookupNetwork(nip.AsSlice()); err == nil && code != "" {
+			list = append(list, Match{Code: code, Rule: network.String()})
+		}
+		return list
+	}
+	for i, set := range f.sets {
+		if !set.Contains(nip) {
+			continue
+		}
+		if f.reverse[i] {
+			list = append(list, Match{Code: f.codes[i], Rule: "reverse match"})
+			continue
+		}
+		for _, prefix := range f.prefixes[i] {
+			if prefix.Contains(nip) {
+				list = append(list, Match{Code: f.codes[i], Rule: prefix.String()})
+			}
+		}
+	}
+	return list
+}
+
+// relation between the ip set of a code and a looked up range
+const (
+	RelationContains  = "contains"  // the code contains the whole range
+	RelationOverlaps  = "overlaps"  // the code contains a part of the range
+	RelationContained = "contained" // all ips of the code are in the range
+)
+
+// Overlap is a code sharing ips with a looked up range, Prefixes are the
+// shared part of them
+type Overlap struct {
+	Code     string
+	Relation string
+	Prefixes []netip.Prefix
+}
+
+// parse a cidr or a range such as "1.0.0.0-1.0.0.255", false for anything else
+func ParseIPRange(value string) (netipx.IPRange, bool) {
+	if prefix, err := netip.ParsePrefix(value); err == nil {
+		return netipx.RangeOfPrefix(prefix.Masked()), true
+	}
+	if r, err := netipx.ParseIPRange(value); err == nil {
+		return r, true
+	}
+	return netipx.IPRange{}, false
+}
+
+// load ip sets of all codes of the mmdb database, they are not needed by Find
+func (f *Finder) loadMMDB() error {
+	codes, err := f.db.Codes()
+	if err != nil {
+		return err
+	}
+	want := make(map[string]bool)
+	for _, code := range codes {
+		want[code] = true
+	}
+	networks, err := f.db.Read(want, IPv4|IPv6)
+	if err != nil {
+		return err
+	}
+	for _, code := range codes {
+		var builder netipx.IPSetBuilder
+		for _, network := range networks[code] {
+			prefix, ok := netipx.FromStdIPNet(network)
+			if !ok {
+				return ErrInvalidIP
+			}
+			builder.AddPrefix(prefix)
+		}
+		set, err := builder.IPSet()
+		if err != nil {
+			return err
+		}
+		f.codes = append(f.codes, code)
+		f.sets = append(f.sets, set)
+	}
+	return nil
+}
+
+// return the codes sharing ips with the range, along with how they overlap
+func (f *Finder) Overlaps(r netipx.IPRange) ([]Overlap, error) {
+	if !r.IsValid() {
+		return nil, fmt.Errorf("invalid ip range: %s", r)
+	}
+	if f.db != nil && f.sets == nil {
+		if err := f.loadMMDB(); err != nil {
+			return nil, err
+		}
+	}
+	var rb netipx.IPSetBuilder
+	rb.AddRange(r)
+	rangeSet, _ := rb.IPSet()
+
+	list := []Overlap{}
+	for i, set := range f.sets {
+		if !set.OverlapsRange(r) {
+			continue
+		}
+		var builder netipx.IPSetBuilder
+		builder.AddSet(set)
+		builder.Intersect(rangeSet)
+		shared, err := builder.IPSet()
+		if err != nil {
+			return nil, err
+		}
+		relation := RelationOverlaps
+		if set.ContainsRange(r) {
+			relation = RelationContains
+		} else if shared.Equal(set) {
+			relation = RelationContained
+		}
+		list = append(list, Overlap{Code: f.codes[i], Relation: relation, Prefixes: shared.Prefixes()})
+	}
+	return list, nil
+}
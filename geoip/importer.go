@@ -0,0 +1,193 @@
+package geoip
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go4.org/netipx"
+)
+
+var errNoCode = errors.New("no code")
+
+// the ip range and code of a csv record, in one of the layouts:
+//
+//	cidr,code
+//	start_ip,end_ip,code,...  (DB-IP country lite)
+//	ip_from,ip_to,code,...    (IP2Location LITE DB1, ips are integers)
+func parseRecord(record []string) (netipx.IPRange, string, error) {
+	if len(record) < 2 {
+		return netipx.IPRange{}, "", errors.New("expecting cidr,code")
+	}
+	for i := range record {
+		record[i] = strings.TrimSpace(record[i])
+	}
+	if len(record) >= 3 {
+		from, fromErr := parseRecordIP(record[0])
+		to, toErr := parseRecordIP(record[1])
+		if fromErr == nil && toErr == nil {
+			if from.Is4() != to.Is4() {
+				from, to = widenIP(from), widenIP(to)
+			}
+			// ipv4 is stored as ipv4-mapped ipv6 by the ipv6 database of IP2Location
+			if from.Is4In6() && to.Is4In6() {
+				from, to = from.Unmap(), to.Unmap()
+			}
+			r := netipx.IPRangeFrom(from, to)
+			if !r.IsValid() {
+				return netipx.IPRange{}, "", fmt.Errorf("invalid range %s-%s", record[0], record[1])
+			}
+			// unassigned ranges of IP2Location
+			if code := record[2]; code != "" && code != "-" {
+				return r, strings.ToUpper(code), nil
+			}
+			return r, "", errNoCode
+		}
+	}
+	r, ok := ParseIPRange(record[0])
+	if !ok {
+		addr, err := netip.ParseAddr(record[0])
+		if err != nil {
+			return netipx.IPRange{}, "", ErrInvalidIP
+		}
+		r = netipx.IPRangeFrom(addr, addr)
+	}
+	if record[1] == "" {
+		return netipx.IPRange{}, "", errors.New("empty code")
+	}
+	return r, strings.ToUpper(record[1]), nil
+}
+
+// an ip address, or an ip number of IP2Location
+func parseRecordIP(value string) (netip.Addr, error) {
+	if addr, err := netip.ParseAddr(value); err == nil {
+		return addr, nil
+	}
+	n, ok := new(big.Int).SetString(value, 10)
+	if !ok || n.Sign() < 0 || n.BitLen() > 128 {
+		return netip.Addr{}, ErrInvalidIP
+	}
+	if n.BitLen() <= 32 {
+		var b [4]byte
+		return netip.AddrFrom4([4]byte(n.FillBytes(b[:]))), nil
+	}
+	var b [16]byte
+	return netip.AddrFrom16([16]byte(n.FillBytes(b[:]))), nil
+}
+
+// an ipv4 address as the ipv6 address of the same number, small ip numbers of
+// the ipv6 database of IP2Location are ipv6 as well
+func widenIP(addr netip.Addr) netip.Addr {
+	if !addr.Is4() {
+		return addr
+	}
+	var b [16]byte
+	v4 := addr.As4()
+	copy(b[12:], v4[:])
+	return netip.AddrFrom16(b)
+}
+
+// add all prefixes of the range
+func (e *Entry) addRange(r netipx.IPRange) error {
+	for _, prefix := range r.Prefixes() {
+		if err := e.AddPrefix(prefix); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// report whether the directory holds the csv files of GeoLite2-Country
+func isMaxMindCSV(dir string) bool {
+	matches, _ := filepath.Glob(filepath.Join(dir, "*-Country-Locations-en.csv"))
+	return len(matches) > 0
+}
+
+// import the Blocks-IPv4, Blocks-IPv6 and Locations-en csv files of GeoLite2-Country,
+// networks are grouped by the iso code of their country, or their registered
+// country if the former is unknown
+func importMaxMind(dir string, entries map[string]*Entry) error {
+	locations, err := filepath.Glob(filepath.Join(dir, "*-Country-Locations-en.csv"))
+	if err != nil {
+		return err
+	}
+	if len(locations) == 0 {
+		return fmt.Errorf("no Locations-en csv in %s", dir)
+	}
+	countries := make(map[string]string)
+	err = readCSVTable(locations[0], func(row map[string]string) error {
+		if code := row["country_iso_code"]; code != "" {
+			countries[row["geoname_id"]] = strings.ToUpper(code)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	blocks, err := filepath.Glob(filepath.Join(dir, "*-Country-Blocks-IPv[46].csv"))
+	if err != nil {
+		return err
+	}
+	if len(blocks) == 0 {
+		return fmt.Errorf("no Blocks-IPv4 or Blocks-IPv6 csv in %s", dir)
+	}
+	for _, file := range blocks {
+		err := readCSVTable(file, func(row map[string]string) error {
+			code, ok := countries[row["geoname_id"]]
+			if !ok {
+				code, ok = countries[row["registered_country_geoname_id"]]
+			}
+			if !ok {
+				return nil // anonymous proxies and satellite providers
+			}
+			entry, ok := entries[code]
+			if !ok {
+				entry = NewEntry(code)
+				entries[code] = entry
+			}
+			return entry.AddPrefix(row["network"])
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// read a csv file with a header, each row is passed as a map of column names to values
+func readCSVTable(path string, fn func(row map[string]string) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	reader := csv.NewReader(file)
+	header, err := reader.Read()
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	row := make(map[string]string, len(header))
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		for i, name := range header {
+			row[name] = record[i]
+		}
+		if err := fn(row); err != nil {
+			line, _ := reader.FieldPos(0)
+			return fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package geoip
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseRecord(t *testing.T) {
+	tests := []struct {
+		name   string
+		record []string
+		want   string // range of the record, empty if an error is expected
+		code   string
+		err    error // expected error, nil to accept any error if want is empty
+	}{
+		{"cidr", []string{"1.0.0.0/24", "au"}, "1.0.0.0-1.0.0.255", "AU", nil},
+		{"single ip", []string{"1.0.0.1", "AU"}, "1.0.0.1-1.0.0.1", "AU", nil},
+		{"cidr with spaces", []string{" 2001:db8::/32 ", " jp "}, "2001:db8::-2001:db8:ffff:ffff:ffff:ffff:ffff:ffff", "JP", nil},
+		{"cidr with extra columns", []string{"1.0.0.0/24", "AU", "Australia"}, "1.0.0.0-1.0.0.255", "AU", nil},
+		{"cidr without code", []string{"1.0.0.0/24", ""}, "", "", nil},
+		{"header", []string{"cidr", "code"}, "", "", ErrInvalidIP},
+		{"too few columns", []string{"1.0.0.0/24"}, "", "", nil},
+		{"db-ip", []string{"1.0.0.0", "1.0.0.255", "AU"}, "1.0.0.0-1.0.0.255", "AU", nil},
+		{"db-ip ipv6", []string{"2001:db8::", "2001:db8::ff", "jp"}, "2001:db8::-2001:db8::ff", "JP", nil},
+		{"ip2location", []string{"16777216", "16777471", "AU", "Australia"}, "1.0.0.0-1.0.0.255", "AU", nil},
+		{"ip2location ipv4-mapped", []string{"281470698520576", "281470698520831", "AU", "Australia"}, "1.0.0.0-1.0.0.255", "AU", nil},
+		{"ip2location ipv6 from zero", []string{"0", "281470681743359", "US", "United States"}, "::-::fffe:ffff:ffff", "US", nil},
+		{"ip2location unassigned", []string{"0", "16777215", "-", "-"}, "", "", errNoCode},
+		{"db-ip without code", []string{"1.0.0.0", "1.0.0.255", ""}, "", "", errNoCode},
+		{"reversed range", []string{"1.0.0.255", "1.0.0.0", "AU"}, "", "", nil},
+		{"reversed ip numbers", []string{"16777471", "16777216", "AU", "Australia"}, "", "", nil},
+		{"ip2location header", []string{"ip_from", "ip_to", "country_code", "country_name"}, "", "", ErrInvalidIP},
+	}
+	for _, tt := range tests {
+		r, code, err := parseRecord(tt.record)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("%s: expected an error, got %s %s", tt.name, r, code)
+			} else if tt.err != nil && !errors.Is(err, tt.err) {
+				t.Errorf("%s: expected %v, got %v", tt.name, tt.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if r.String() != tt.want || code != tt.code {
+			t.Errorf("%s: expected %s %s, got %s %s", tt.name, tt.want, tt.code, r, code)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package geoip
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"sort"
+	"strings"
+
+	"go4.org/netipx"
+)
+
+// MergeGeoIP combines the lists into one, cidr of the same code are united with
+// overlapping and adjacent ranges merged. a code must be reverse_match in all
+// lists or in none of them, reverse match entries keep only the cidr found in
+// all of them, so the merged entry matches what any of them matches
+func MergeGeoIP(lists ...*GeoIPList) (*GeoIPList, error) {
+	entries := make(map[string]*Entry)
+	reverse := make(map[string]*netipx.IPSet)
+	for _, list := range lists {
+		for _, geoip := range list.Entry {
+			code := strings.ToUpper(geoip.CountryCode)
+			entry, ok := entries[code]
+			set, isReverse := reverse[code]
+			if ok && geoip.ReverseMatch || isReverse && !geoip.ReverseMatch {
+				return nil, fmt.Errorf("%s is reverse_match in some inputs but not in others", code)
+			}
+			if geoip.ReverseMatch {
+				cidr, err := cidrSet(geoip)
+				if err != nil {
+					return nil, err
+				}
+				if isReverse {
+					var builder netipx.IPSetBuilder
+					builder.AddSet(set)
+					builder.Intersect(cidr)
+					if cidr, err = builder.IPSet(); err != nil {
+						return nil, err
+					}
+				}
+				reverse[code] = cidr
+				continue
+			}
+			if !ok {
+				entry = NewEntry(code)
+				entries[code] = entry
+			}
+			if err := entry.addGeoIP(geoip); err != nil {
+				return nil, err
+			}
+		}
+	}
+	merged, err := EntriesToGeoIP(entries)
+	if err != nil {
+		return nil, err
+	}
+	// kept even without cidr, as they match everything then
+	for code, set := range reverse {
+		geoip := &GeoIP{CountryCode: code, ReverseMatch: true}
+		for _, prefix := range set.Prefixes() {
+			geoip.Cidr = append(geoip.Cidr, &CIDR{
+				Ip:     prefix.Addr().AsSlice(),
+				Prefix: uint32(prefix.Bits()),
+			})
+		}
+		merged.Entry = append(merged.Entry, geoip)
+	}
+	// Sort protoList so the marshaled list is reproducible
+	sort.SliceStable(merged.Entry, func(i, j int) bool {
+		return merged.Entry[i].CountryCode < merged.Entry[j].CountryCode
+	})
+	return merged, nil
+}
+
+// FilterIPType keeps the cidr of the ip versions only, entries left without
+// cidr are removed. reverse match entries get the whole range of the other
+// version instead, so that they don't match it either
+func FilterIPType(list *GeoIPList, ipType IPType) {
+	allowIPv4 := ipType&IPv4 != 0
+	allowIPv6 := ipType&IPv6 != 0
+	entries := list.Entry[:0]
+	for _, geoip := range list.Entry {
+		cidrs := geoip.Cidr[:0]
+		for _, cidr := range geoip.Cidr {
+			if net.IP(cidr.Ip).To4() != nil && allowIPv4 || net.IP(cidr.Ip).To4() == nil && allowIPv6 {
+				cidrs = append(cidrs, cidr)
+			}
+		}
+		geoip.Cidr = cidrs
+		if geoip.ReverseMatch {
+			if !allowIPv4 {
+				geoip.Cidr = append(geoip.Cidr, &CIDR{Ip: net.IPv4zero.To4()})
+			}
+			if !allowIPv6 {
+				geoip.Cidr = append(geoip.Cidr, &CIDR{Ip: net.IPv6zero})
+			}
+		}
+		if len(geoip.Cidr) > 0 || geoip.ReverseMatch {
+			entries = append(entries, geoip)
+		}
+	}
+	list.Entry = entries
+}
+
+// DiffGeoIP compares two versions of a code by the addresses they cover, no
+// matter how the ranges are split into cidr. Either of them can be nil
+func DiffGeoIP(before, after *GeoIP) (added, removed []netip.Prefix, err error) {
+	beforeSet, err := geoipSet(before)
+	if err != nil {
+		return nil, nil, err
+	}
+	afterSet, err := geoipSet(after)
+	if err != nil {
+		return nil, nil, err
+	}
+	var addedBuilder, removedBuilder netipx.IPSetBuilder
+	addedBuilder.AddSet(afterSet)
+	addedBuilder.RemoveSet(beforeSet)
+	removedBuilder.AddSet(beforeSet)
+	removedBuilder.RemoveSet(afterSet)
+	addedSet, err := addedBuilder.IPSet()
+	if err != nil {
+		return nil, nil, err
+	}
+	removedSet, err := removedBuilder.IPSet()
+	if err != nil {
+		return nil, nil, err
+	}
+	return addedSet.Prefixes(), removedSet.Prefixes(), nil
+}
+
+// the addresses matched by the entry, which are all but its cidr for reverse
+// match entries
+func geoipSet(geoip *GeoIP) (*netipx.IPSet, error) {
+	set, err := cidrSet(geoip)
+	if err != nil || !geoip.GetReverseMatch() {
+		return set, err
+	}
+	var builder netipx.IPSetBuilder
+	builder.AddSet(set)
+	builder.Complement()
+	return builder.IPSet()
+}
+
+// the set of the cidr listed by the entry
+func cidrSet(geoip *GeoIP) (*netipx.IPSet, error) {
+	var builder netipx.IPSetBuilder
+	entry := NewEntry(geoip.GetCountryCode())
+	if err := entry.addGeoIP(geoip); err != nil {
+		return nil, err
+	}
+	prefixes, err := entry.MarshalPrefix()
+	if err != nil && !errors.Is(err, ErrEmptyEntry) {
+		return nil, err
+	}
+	for _, prefix := range prefixes {
+		builder.AddPrefix(prefix)
+	}
+	return builder.IPSet()
+}
+
+// add the cidr of a v2ray GeoIP entry
+func (e *Entry) addGeoIP(geoip *GeoIP) error {
+	for _, cidr := range geoip.GetCidr() {
+		addr, ok := netip.AddrFromSlice(cidr.Ip)
+		if !ok {
+			return ErrInvalidIP
+		}
+		if err := e.AddPrefix(netip.PrefixFrom(addr, int(cidr.Prefix))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package geoip
+
+import (
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+// a GeoIP entry of the cidr
+func testGeoIP(cidrs ...string) *GeoIP {
+	geoip := &GeoIP{CountryCode: "TEST"}
+	for _, cidr := range cidrs {
+		prefix := netip.MustParsePrefix(cidr)
+		geoip.Cidr = append(geoip.Cidr, &CIDR{
+			Ip:     prefix.Addr().AsSlice(),
+			Prefix: uint32(prefix.Bits()),
+		})
+	}
+	return geoip
+}
+
+// a reverse match GeoIP entry of the cidr
+func testReverseGeoIP(cidrs ...string) *GeoIP {
+	geoip := testGeoIP(cidrs...)
+	geoip.ReverseMatch = true
+	return geoip
+}
+
+func joinCIDR(geoip *GeoIP) string {
+	list := make([]string, len(geoip.Cidr))
+	for i, cidr := range geoip.Cidr {
+		addr, _ := netip.AddrFromSlice(cidr.Ip)
+		list[i] = netip.PrefixFrom(addr, int(cidr.Prefix)).String()
+	}
+	return strings.Join(list, ",")
+}
+
+func joinPrefixes(prefixes []netip.Prefix) string {
+	list := make([]string, len(prefixes))
+	for i, prefix := range prefixes {
+		list[i] = prefix.String()
+	}
+	return strings.Join(list, ",")
+}
+
+func TestMergeGeoIP(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []*GeoIP
+		cidr    string // "error" if an error is expected
+		reverse bool
+	}{
+		{"union", []*GeoIP{testGeoIP("1.0.0.0/25"), testGeoIP("1.0.0.128/25", "2001:db8::/32")}, "1.0.0.0/24,2001:db8::/32", false},
+		{"reverse", []*GeoIP{testReverseGeoIP("1.0.0.0/24", "10.0.0.0/8"), testReverseGeoIP("1.0.0.0/25", "10.0.0.0/8")}, "1.0.0.0/25,10.0.0.0/8", true},
+		{"reverse without common cidr", []*GeoIP{testReverseGeoIP("1.0.0.0/24"), testReverseGeoIP("2001:db8::/32")}, "", true},
+		{"reverse after normal", []*GeoIP{testGeoIP("1.0.0.0/24"), testReverseGeoIP("1.0.0.0/24")}, "error", false},
+		{"normal after reverse", []*GeoIP{testReverseGeoIP("1.0.0.0/24"), testGeoIP("1.0.0.0/24")}, "error", false},
+	}
+	for _, tt := range tests {
+		var lists []*GeoIPList
+		for _, entry := range tt.entries {
+			lists = append(lists, &GeoIPList{Entry: []*GeoIP{entry}})
+		}
+		merged, err := MergeGeoIP(lists...)
+		if tt.cidr == "error" {
+			if err == nil {
+				t.Errorf("%s: expected an error", tt.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if len(merged.Entry) != 1 {
+			t.Errorf("%s: expected 1 entry, got %d", tt.name, len(merged.Entry))
+			continue
+		}
+		if got := joinCIDR(merged.Entry[0]); got != tt.cidr {
+			t.Errorf("%s: expected cidr %q, got %q", tt.name, tt.cidr, got)
+		}
+		if merged.Entry[0].ReverseMatch != tt.reverse {
+			t.Errorf("%s: expected reverse_match %v", tt.name, tt.reverse)
+		}
+	}
+}
+
+func TestFilterIPType(t *testing.T) {
+	tests := []struct {
+		name   string
+		entry  *GeoIP
+		ipType IPType
+		cidr   string // "" if the entry is removed
+	}{
+		{"ipv4", testGeoIP("1.0.0.0/24", "2001:db8::/32"), IPv4, "1.0.0.0/24"},
+		{"ipv6", testGeoIP("1.0.0.0/24", "2001:db8::/32"), IPv6, "2001:db8::/32"},
+		{"both", testGeoIP("1.0.0.0/24", "2001:db8::/32"), IPv4 | IPv6, "1.0.0.0/24,2001:db8::/32"},
+		{"emptied", testGeoIP("1.0.0.0/24"), IPv6, ""},
+		{"reverse ipv4", testReverseGeoIP("1.0.0.0/24", "2001:db8::/32"), IPv4, "1.0.0.0/24,::/0"},
+		{"reverse ipv6", testReverseGeoIP("1.0.0.0/24"), IPv6, "0.0.0.0/0"},
+	}
+	for _, tt := range tests {
+		list := &GeoIPList{Entry: []*GeoIP{tt.entry}}
+		FilterIPType(list, tt.ipType)
+		if tt.cidr == "" {
+			if len(list.Entry) != 0 {
+				t.Errorf("%s: expected the entry to be removed", tt.name)
+			}
+			continue
+		}
+		if len(list.Entry) != 1 {
+			t.Errorf("%s: expected 1 entry, got %d", tt.name, len(list.Entry))
+			continue
+		}
+		if got := joinCIDR(list.Entry[0]); got != tt.cidr {
+			t.Errorf("%s: expected cidr %q, got %q", tt.name, tt.cidr, got)
+		}
+	}
+}
+
+func TestDiffGeoIP(t *testing.T) {
+	tests := []struct {
+		name    string
+		before  *GeoIP
+		after   *GeoIP
+		added   string
+		removed string
+	}{
+		{"same cidr", testGeoIP("1.0.0.0/24"), testGeoIP("1.0.0.0/24"), "", ""},
+		{"split differently", testGeoIP("1.0.0.0/24"), testGeoIP("1.0.0.128/25", "1.0.0.0/25"), "", ""},
+		{"overlapping cidr", testGeoIP("1.0.0.0/24", "1.0.0.0/25"), testGeoIP("1.0.0.0/24"), "", ""},
+		{"grown", testGeoIP("1.0.0.0/25"), testGeoIP("1.0.0.0/24"), "1.0.0.128/25", ""},
+		{"shrunk", testGeoIP("1.0.0.0/24", "2001:db8::/32"), testGeoIP("1.0.0.0/25"), "", "1.0.0.128/25,2001:db8::/32"},
+		{"moved", testGeoIP("1.0.0.0/24"), testGeoIP("1.0.1.0/24"), "1.0.1.0/24", "1.0.0.0/24"},
+		{"added code", nil, testGeoIP("1.0.0.0/24"), "1.0.0.0/24", ""},
+		{"removed code", testGeoIP("2001:db8::/32"), nil, "", "2001:db8::/32"},
+		{"empty code", testGeoIP(), testGeoIP("1.0.0.0/24"), "1.0.0.0/24", ""},
+		{"reverse match flipped", testGeoIP("1.0.0.0/1"), testReverseGeoIP("1.0.0.0/1"), "128.0.0.0/1,::/0", "0.0.0.0/1"},
+		{"reverse cidr shrunk", testReverseGeoIP("1.0.0.0/24"), testReverseGeoIP("1.0.0.0/25"), "1.0.0.128/25", ""},
+		{"reverse code added", nil, testReverseGeoIP("0.0.0.0/0", "::/1"), "8000::/1", ""},
+	}
+	for _, tt := range tests {
+		added, removed, err := DiffGeoIP(tt.before, tt.after)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got := joinPrefixes(added); got != tt.added {
+			t.Errorf("%s: expected added %q, got %q", tt.name, tt.added, got)
+		}
+		if got := joinPrefixes(removed); got != tt.removed {
+			t.Errorf("%s: expected removed %q, got %q", tt.name, tt.removed, got)
+		}
+	}
+}
+
+func TestDiffGeoIPInvalidIP(t *testing.T) {
+	invalid := &GeoIP{CountryCode: "TEST", Cidr: []*CIDR{{Ip: []byte{1, 2, 3}, Prefix: 24}}}
+	if _, _, err := DiffGeoIP(invalid, testGeoIP("1.0.0.0/24")); err == nil {
+		t.Error("expected an error for an invalid ip")
+	}
+}
@@ -0,0 +1,275 @@
+package geoip
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/maxmind/mmdbwriter"
+	"github.com/maxmind/mmdbwriter/inserter"
+	"github.com/maxmind/mmdbwriter/mmdbtype"
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// database type of the sing-box geoip.db, whose record is the country code itself
+const singGeoIPType = "sing-geoip"
+
+// record layout of GeoLite2-Country and compatible databases
+type countryRecord struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	RegisteredCountry struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"registered_country"`
+}
+
+// MMDB reads sing-box geoip.db and MaxMind country databases
+type MMDB struct {
+	reader *maxminddb.Reader
+}
+
+func LoadMMDB(path string) (*MMDB, error) {
+	reader, err := maxminddb.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &MMDB{reader: reader}, nil
+}
+
+// maxmind databases end with the metadata, which starts with this marker
+var metadataStartMarker = []byte("\xAB\xCD\xEFMaxMind.com")
+
+// load a database from a reader, the whole database is read into memory. the
+// metadata marker is checked first so other files are not read entirely
+func LoadMMDBFromReader(r io.ReaderAt, size int64) (*MMDB, error) {
+	tail := make([]byte, min(size, 128*1024))
+	if _, err := r.ReadAt(tail, size-int64(len(tail))); err != nil && err != io.EOF {
+		return nil, err
+	}
+	if !bytes.Contains(tail, metadataStartMarker) {
+		return nil, errors.New("not a maxmind database")
+	}
+	data := make([]byte, size)
+	if _, err := r.ReadAt(data, 0); err != nil && err != io.EOF {
+		return nil, err
+	}
+	reader, err := maxminddb.FromBytes(data)
+	if err != nil {
+		return nil, err
+	}
+	return &MMDB{reader: reader}, nil
+}
+
+func (m *MMDB) Close() error {
+	return m.reader.Close()
+}
+
+func (m *MMDB) isSing() bool {
+	return m.reader.Metadata.DatabaseType == singGeoIPType
+}
+
+// decode the country code of the current network, codes are always uppercased
+func (m *MMDB) network(networks *maxminddb.Networks) (*net.IPNet, string, error) {
+	if m.isSing() {
+		var code string
+		network, err := networks.Network(&code)
+		return network, strings.ToUpper(code), err
+	}
+	var record countryRecord
+	network, err := networks.Network(&record)
+	code := record.Country.ISOCode
+	if code == "" {
+		code = record.RegisteredCountry.ISOCode
+	}
+	return network, strings.ToUpper(code), err
+}
+
+// list all stored codes in the database
+func (m *MMDB) Codes() ([]string, error) {
+	var codes []string
+	if m.isSing() {
+		// sing-box stores all codes in the metadata
+		for _, code := range m.reader.Metadata.Languages {
+			codes = append(codes, strings.ToUpper(code))
+		}
+	} else {
+		codeMap := make(map[string]struct{})
+		networks := m.reader.Networks(maxminddb.SkipAliasedNetworks)
+		for networks.Next() {
+			_, code, err := m.network(networks)
+			if err != nil {
+				return nil, err
+			}
+			if code != "" {
+				codeMap[code] = struct{}{}
+			}
+		}
+		if err := networks.Err(); err != nil {
+			return nil, err
+		}
+		for code := range codeMap {
+			codes = append(codes, code)
+		}
+	}
+	sort.Strings(codes)
+	return codes, nil
+}
+
+// find the code of an ip, empty if not found
+func (m *MMDB) Lookup(ip net.IP) (string, error) {
+	code, _, err := m.LookupNetwork(ip)
+	return code, err
+}
+
+// find the code of an ip and the network containing it, empty if not found
+func (m *MMDB) LookupNetwork(ip net.IP) (string, *net.IPNet, error) {
+	if m.isSing() {
+		var code string
+		network, _, err := m.reader.LookupNetwork(ip, &code)
+		return strings.ToUpper(code), network, err
+	}
+	var record countryRecord
+	network, _, err := m.reader.LookupNetwork(ip, &record)
+	if err != nil {
+		return "", nil, err
+	}
+	code := record.Country.ISOCode
+	if code == "" {
+		code = record.RegisteredCountry.ISOCode
+	}
+	return strings.ToUpper(code), network, nil
+}
+
+// read networks of the wanted codes, grouped by code
+func (m *MMDB) Read(want map[string]bool, iptype IPType) (map[string][]*net.IPNet, error) {
+	allowIPv4 := iptype&IPv4 != 0
+	allowIPv6 := iptype&IPv6 != 0
+	list := make(map[string][]*net.IPNet)
+	networks := m.reader.Networks(maxminddb.SkipAliasedNetworks)
+	for networks.Next() {
+		network, code, err := m.network(networks)
+		if err != nil {
+			return nil, err
+		}
+		if !want[code] {
+			continue
+		}
+		if _, ok := list[code]; !ok {
+			list[code] = nil // the code exists even if all its networks are filtered out
+		}
+		if network.IP.To4() != nil {
+			if !allowIPv4 {
+				continue
+			}
+		} else if !allowIPv6 {
+			continue
+		}
+		list[code] = append(list[code], network)
+	}
+	if err := networks.Err(); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (g *GeoIPDatIn) readMMDB(db *MMDB, iptype IPType) (map[string][]*net.IPNet, []string, error) {
+	networks, err := db.Read(g.Want, iptype)
+	if err != nil {
+		return nil, nil, err
+	}
+	var codes []string
+	for code := range g.Want {
+		if _, ok := networks[code]; ok {
+			codes = append(codes, code)
+		} else if g.MustExist {
+			return nil, nil, fmt.Errorf("%s doesn't exist", code)
+		}
+	}
+	sort.Strings(codes)
+	return networks, codes, nil
+}
+
+func (g *GeoIPDatIn) generateEntriesFromMMDB(db *MMDB, iptype IPType) (error, []string) {
+	networks, codes, err := g.readMMDB(db, iptype)
+	if err != nil {
+		return err, nil
+	}
+	var list []string
+	for _, code := range codes {
+		for _, network := range networks[code] {
+			list = append(list, network.String())
+		}
+	}
+	return nil, list
+}
+
+func (g *GeoIPDatIn) mmdbToGeoIP(db *MMDB) (*GeoIPList, error) {
+	networks, codes, err := g.readMMDB(db, IPv4|IPv6)
+	if err != nil {
+		return nil, err
+	}
+	ipList := new(GeoIPList)
+	for _, code := range codes {
+		geoip := &GeoIP{
+			CountryCode: code,
+		}
+		for _, network := range networks[code] {
+			ones, _ := network.Mask.Size()
+			geoip.Cidr = append(geoip.Cidr, &CIDR{
+				Ip:     network.IP,
+				Prefix: uint32(ones),
+			})
+		}
+		ipList.Entry = append(ipList.Entry, geoip)
+	}
+	return ipList, nil
+}
+
+// write v2ray geoip entries into a sing-box geoip.db, which is a maxmind database
+// with the lowercased country code as the record value
+func WriteMMDB(writer io.Writer, list *GeoIPList) error {
+	codes := make([]string, 0, len(list.Entry))
+	for _, entry := range list.Entry {
+		codes = append(codes, strings.ToLower(entry.CountryCode))
+	}
+	sort.Strings(codes)
+	tree, err := mmdbwriter.New(mmdbwriter.Options{
+		DatabaseType:            singGeoIPType,
+		Languages:               codes,
+		IPVersion:               6,
+		RecordSize:              24,
+		Inserter:                inserter.ReplaceWith,
+		DisableIPv4Aliasing:     true,
+		IncludeReservedNetworks: true,
+	})
+	if err != nil {
+		return err
+	}
+	for _, entry := range list.Entry {
+		if entry.ReverseMatch {
+			return fmt.Errorf("%s is a reverse match entry, which can't be stored in mmdb", entry.CountryCode)
+		}
+		code := mmdbtype.String(strings.ToLower(entry.CountryCode))
+		for _, v2rayCIDR := range entry.Cidr {
+			ip := net.IP(v2rayCIDR.GetIp())
+			bits := len(ip) * 8
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 32
+			}
+			network := &net.IPNet{
+				IP:   ip,
+				Mask: net.CIDRMask(int(v2rayCIDR.GetPrefix()), bits),
+			}
+			if err := tree.Insert(network, code); err != nil {
+				return err
+			}
+		}
+	}
+	_, err = tree.WriteTo(writer)
+	return err
+}
@@ -0,0 +1,230 @@
+package geosite
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var sourceRuleType = map[string]Domain_Type{
+	"domain":  Domain_Domain,
+	"full":    Domain_Full,
+	"keyword": Domain_Plain,
+	"regexp":  Domain_Regex,
+}
+
+// a list of domain-list-community before its includes are resolved
+type sourceList struct {
+	domains  []*Domain
+	includes []sourceInclude
+}
+
+type sourceInclude struct {
+	code    string
+	filters []string // attribute filters in the syntax of "code@attr"
+}
+
+type listBuilder struct {
+	lists    map[string]*sourceList
+	resolved map[string][]*Domain
+	visiting map[string]bool
+}
+
+// BuildGeoSite compiles a data directory of domain-list-community, each file is
+// a list named after the file
+func BuildGeoSite(dir string) (*GeoSiteList, error) {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	b := &listBuilder{
+		lists:    make(map[string]*sourceList),
+		resolved: make(map[string][]*Domain),
+		visiting: make(map[string]bool),
+	}
+	for _, file := range files {
+		if file.IsDir() || strings.HasPrefix(file.Name(), ".") {
+			continue
+		}
+		if err := b.parseFile(filepath.Join(dir, file.Name())); err != nil {
+			return nil, err
+		}
+	}
+
+	geolist := new(GeoSiteList)
+	for code := range b.lists {
+		domains, err := b.resolve(code)
+		if err != nil {
+			return nil, err
+		}
+		geolist.Entry = append(geolist.Entry, &GeoSite{
+			CountryCode: code,
+			Domain:      domains,
+		})
+	}
+	// Sort protoList so the marshaled list is reproducible
+	sort.SliceStable(geolist.Entry, func(i, j int) bool {
+		return geolist.Entry[i].CountryCode < geolist.Entry[j].CountryCode
+	})
+	return geolist, nil
+}
+
+func (b *listBuilder) list(code string) *sourceList {
+	code = strings.ToUpper(code)
+	if b.lists[code] == nil {
+		b.lists[code] = new(sourceList)
+	}
+	return b.lists[code]
+}
+
+func (b *listBuilder) parseFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	list := b.list(filepath.Base(path))
+	scanner := bufio.NewScanner(file)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if err := b.parseLine(list, fields); err != nil {
+			return fmt.Errorf("%s:%d: %w", path, lineNo, err)
+		}
+	}
+	return scanner.Err()
+}
+
+// a line is "type:value" followed by "@attr" and "&affiliation", or "include:list" followed by "@attr" or "@-attr" filters
+func (b *listBuilder) parseLine(list *sourceList, fields []string) error {
+	var attrs, affiliations []string
+	for _, field := range fields[1:] {
+		switch {
+		case strings.HasPrefix(field, "@") && len(field) > 1:
+			attrs = append(attrs, strings.ToLower(field[1:]))
+		case strings.HasPrefix(field, "&") && len(field) > 1:
+			affiliations = append(affiliations, field[1:])
+		default:
+			return fmt.Errorf("invalid field: %s", field)
+		}
+	}
+
+	ruleType, value, found := strings.Cut(fields[0], ":")
+	if !found {
+		ruleType, value = "domain", fields[0]
+	}
+	if ruleType == "include" {
+		if len(affiliations) > 0 {
+			return fmt.Errorf("affiliation of include:%s is not supported", value)
+		}
+		include := sourceInclude{code: strings.ToUpper(value)}
+		for _, attr := range attrs {
+			if after, ok := strings.CutPrefix(attr, "-"); ok {
+				attr = "!" + after
+			}
+			include.filters = append(include.filters, attr)
+		}
+		list.includes = append(list.includes, include)
+		return nil
+	}
+
+	tp, ok := sourceRuleType[ruleType]
+	if !ok {
+		return fmt.Errorf("unknown rule type: %s", ruleType)
+	}
+	if tp == Domain_Regex {
+		if _, err := regexp.Compile(value); err != nil {
+			return err
+		}
+	} else {
+		value = strings.ToLower(value)
+	}
+	if value == "" {
+		return fmt.Errorf("empty %s rule", ruleType)
+	}
+	domain := &Domain{Type: tp, Value: value}
+	sort.Strings(attrs)
+	for _, attr := range attrs {
+		domain.Attribute = append(domain.Attribute, &Domain_Attribute{
+			Key:        attr,
+			TypedValue: &Domain_Attribute_BoolValue{BoolValue: true},
+		})
+	}
+	list.domains = append(list.domains, domain)
+	for _, affiliation := range affiliations {
+		aff := b.list(affiliation)
+		aff.domains = append(aff.domains, domain)
+	}
+	return nil
+}
+
+// the domains of the list with all includes expanded, deduplicated and sorted
+func (b *listBuilder) resolve(code string) ([]*Domain, error) {
+	if domains, ok := b.resolved[code]; ok {
+		return domains, nil
+	}
+	list, ok := b.lists[code]
+	if !ok {
+		return nil, fmt.Errorf("%s doesn't exist", code)
+	}
+	if b.visiting[code] {
+		return nil, fmt.Errorf("circular include of %s", code)
+	}
+	b.visiting[code] = true
+	defer delete(b.visiting, code)
+
+	domains := append([]*Domain{}, list.domains...)
+	for _, include := range list.includes {
+		included, err := b.resolve(include.code)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", code, err)
+		}
+		domains = append(domains, filterDomains(included, include.filters)...)
+	}
+
+	domains = uniqDomains(domains)
+	b.resolved[code] = domains
+	return domains, nil
+}
+
+// remove duplicated domains and sort the rest by type and value
+func uniqDomains(domains []*Domain) []*Domain {
+	seen := make(map[string]bool)
+	unique := domains[:0]
+	for _, domain := range domains {
+		key := domainKey(domain)
+		if !seen[key] {
+			seen[key] = true
+			unique = append(unique, domain)
+		}
+	}
+	sort.SliceStable(unique, func(i, j int) bool {
+		if unique[i].Type != unique[j].Type {
+			return unique[i].Type < unique[j].Type
+		}
+		return domainKey(unique[i]) < domainKey(unique[j])
+	})
+	return unique
+}
+
+// the rule of the domain with its attributes sorted, e.g. "domain:google.com @cn"
+func domainKey(domain *Domain) string {
+	attrs := make([]string, 0, len(domain.Attribute))
+	for _, attr := range domain.Attribute {
+		attrs = append(attrs, attr.Key)
+	}
+	sort.Strings(attrs)
+	key := domainRulePrefix[domain.Type] + domain.Value
+	for _, attr := range attrs {
+		key += " @" + attr
+	}
+	return key
+}
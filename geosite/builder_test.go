@@ -0,0 +1,114 @@
+package geosite
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// a builder of the lists, each line is a line of the list file
+func testBuilder(t *testing.T, lists map[string][]string) *listBuilder {
+	b := &listBuilder{
+		lists:    make(map[string]*sourceList),
+		resolved: make(map[string][]*Domain),
+		visiting: make(map[string]bool),
+	}
+	for code, lines := range lists {
+		list := b.list(code)
+		for _, line := range lines {
+			if err := b.parseLine(list, strings.Fields(line)); err != nil {
+				t.Fatalf("%s: %s: %v", code, line, err)
+			}
+		}
+	}
+	return b
+}
+
+func TestListBuilderResolve(t *testing.T) {
+	lists := map[string][]string{
+		"google": {
+			"google.com @cn",
+			"full:www.google.com",
+			"keyword:google @ads",
+			"include:youtube",
+		},
+		"youtube": {
+			"youtube.com",
+			"ytimg.com @cn &cdn",
+			"include:cdn",
+		},
+		"cdn": {
+			"jsdelivr.net",
+		},
+		"google-cn":  {"include:google @cn"},
+		"google-!cn": {"include:google @-cn"},
+		"cycle-a":    {"a.com", "include:cycle-b"},
+		"cycle-b":    {"b.com", "include:cycle-a"},
+		"self":       {"include:self"},
+		"missing":    {"include:nonexistent"},
+	}
+	tests := []struct {
+		code string
+		want []string // nil if an error is expected
+	}{
+		{"CDN", []string{"domain:jsdelivr.net", "domain:ytimg.com @cn"}},
+		{"YOUTUBE", []string{"domain:jsdelivr.net", "domain:youtube.com", "domain:ytimg.com @cn"}},
+		{"GOOGLE", []string{
+			"keyword:google @ads",
+			"domain:google.com @cn",
+			"domain:jsdelivr.net",
+			"domain:youtube.com",
+			"domain:ytimg.com @cn",
+			"full:www.google.com",
+		}},
+		{"GOOGLE-CN", []string{"domain:google.com @cn", "domain:ytimg.com @cn"}},
+		{"GOOGLE-!CN", []string{
+			"keyword:google @ads",
+			"domain:jsdelivr.net",
+			"domain:youtube.com",
+			"full:www.google.com",
+		}},
+		{"CYCLE-A", nil},
+		{"SELF", nil},
+		{"MISSING", nil},
+	}
+	b := testBuilder(t, lists)
+	for _, tt := range tests {
+		domains, err := b.resolve(tt.code)
+		if tt.want == nil {
+			if err == nil {
+				t.Errorf("%s: expected an error", tt.code)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.code, err)
+			continue
+		}
+		got := make([]string, len(domains))
+		for i, domain := range domains {
+			got[i] = domainKey(domain)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: expected %v, got %v", tt.code, tt.want, got)
+		}
+	}
+}
+
+func TestListBuilderResolveDuplicates(t *testing.T) {
+	b := testBuilder(t, map[string][]string{
+		"a": {"Example.com", "example.com", "include:b"},
+		"b": {"example.com", "example.com @cn"},
+	})
+	domains, err := b.resolve("A")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make([]string, len(domains))
+	for i, domain := range domains {
+		got[i] = domainKey(domain)
+	}
+	if want := []string{"domain:example.com", "domain:example.com @cn"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
@@ -0,0 +1,155 @@
+package geosite
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/snowie2000/geoview/codeset"
+	"github.com/snowie2000/geoview/srs"
+)
+
+// ExprHandler evaluates a code expression on top of another handler, the want
+// lists passed to its methods are ignored in favor of the expression
+type ExprHandler struct {
+	GSHandler
+	Expr codeset.Expr
+}
+
+func NewExprHandler(handler GSHandler, expr codeset.Expr) GSHandler {
+	return &ExprHandler{handler, expr}
+}
+
+// split "code@attr1@attr2" into the uppercased code and lowercased attributes
+func ParseCode(code string) (string, []string) {
+	parts := strings.Split(strings.ToLower(strings.TrimSpace(code)), "@") // attributes are lowercased
+	return strings.ToUpper(parts[0]), parts[1:]
+}
+
+func (h *ExprHandler) items(regex bool, keyword bool) ([]Item, error) {
+	var result []Item
+	for _, term := range h.Expr {
+		code, attrs := ParseCode(term.Code)
+		items, err := h.GSHandler.ExtractItems(map[string][]string{code: attrs}, regex)
+		if err != nil {
+			return nil, err
+		}
+		switch term.Op {
+		case codeset.Union:
+			result = append(result, items...)
+		case codeset.Exclude:
+			set := newItemSet(items)
+			list := result[:0]
+			for _, it := range result {
+				if !set.covers(it) {
+					list = append(list, it)
+				}
+			}
+			result = list
+		case codeset.Intersect:
+			// the narrower rule of each overlapping pair is kept
+			set, current := newItemSet(items), newItemSet(result)
+			var list []Item
+			for _, it := range result {
+				if set.covers(it) {
+					list = append(list, it)
+				}
+			}
+			for _, it := range items {
+				if current.covers(it) {
+					list = append(list, it)
+				}
+			}
+			result = list
+		}
+	}
+	list := result[:0]
+	for _, it := range uniqItems(result) {
+		// regex rules are dropped along with keywords, the same as the readers
+		if keyword || (it.Type != RuleTypeDomainKeyword && it.Type != RuleTypeDomainRegex) {
+			list = append(list, it)
+		}
+	}
+	return list, nil
+}
+
+func (h *ExprHandler) Extract(wantList map[string][]string, regex bool) ([]string, error) {
+	items, err := h.items(regex, false)
+	if err != nil {
+		return nil, err
+	}
+	return itemValues(items), nil
+}
+
+func (h *ExprHandler) ExtractItems(wantList map[string][]string, regex bool) ([]Item, error) {
+	return h.items(regex, true)
+}
+
+func (h *ExprHandler) ToGeosite(wantList map[string][]string) (*GeoSiteList, error) {
+	return nil, errors.New("set operators are not supported by database output")
+}
+
+func (h *ExprHandler) ToRuleSet(wantList map[string][]string, regex bool) (*srs.PlainRuleSetCompat, error) {
+	items, err := h.items(regex, false)
+	if err != nil {
+		return nil, err
+	}
+	if len(items) == 0 {
+		return nil, errors.New("empty domain set")
+	}
+	return itemToRuleset(items)
+}
+
+// a set of domain rules telling whether all domains of a rule are matched by
+// the set, regex rules are only covered by identical ones
+type itemSet struct {
+	exact map[itemKey]struct{}
+	// suffixes without the leading dot, true if the suffix matches the domain itself as well
+	suffixes map[string]bool
+	keywords []string
+}
+
+func newItemSet(items []Item) *itemSet {
+	s := &itemSet{
+		exact:    make(map[itemKey]struct{}, len(items)),
+		suffixes: make(map[string]bool),
+	}
+	for _, it := range items {
+		s.exact[keyOf(it)] = struct{}{}
+		switch it.Type {
+		case RuleTypeDomainSuffix:
+			suffix, subOnly := strings.CutPrefix(it.Value, ".")
+			s.suffixes[suffix] = s.suffixes[suffix] || !subOnly
+		case RuleTypeDomainKeyword:
+			s.keywords = append(s.keywords, it.Value)
+		}
+	}
+	return s
+}
+
+func (s *itemSet) covers(it Item) bool {
+	if _, ok := s.exact[keyOf(it)]; ok {
+		return true
+	}
+	if it.Type == RuleTypeDomainRegex {
+		return false
+	}
+	value, subOnly := strings.CutPrefix(it.Value, ".")
+	for _, keyword := range s.keywords {
+		if strings.Contains(value, keyword) {
+			return true
+		}
+	}
+	if it.Type == RuleTypeDomainKeyword {
+		return false
+	}
+	if self, ok := s.suffixes[value]; ok && (self || it.Type == RuleTypeDomainSuffix && subOnly) {
+		return true
+	}
+	for i := strings.IndexByte(value, '.'); i >= 0; i = strings.IndexByte(value, '.') {
+		value = value[i+1:]
+		if _, ok := s.suffixes[value]; ok {
+			return true
+		}
+	}
+	return false
+}
@@ -6,7 +6,6 @@ import (
 	"sort"
 	"strings"
 
-	"github.com/sagernet/sing/common"
 	"github.com/snowie2000/geoview/srs"
 )
 
@@ -19,14 +18,14 @@ func (r *GSReaderLowMem) Lookup(domain string) ([]string, error) {
 	matchedList := []string{}
 
 	// try sing-box geosite
-	geoReader, codes, err := LoadSingSiteFromFile(r.File)
+	geoReader, codes, err := r.loadSingSite()
 	if err == nil && len(codes) > 0 {
 		for _, code := range codes {
 			wantList := map[string][]string{
 				code: nil,
 			}
 			if _, items, err := r.extractSingGeoSite(geoReader, []string{code}, wantList, true, true); err == nil {
-				if ok, _ := r.matchSiteAgainstList(singItemToV2(items), domain); ok {
+				if ok, _ := r.matchSiteAgainstList(SingItemToV2(items), domain); ok {
 					matchedList = append(matchedList, code)
 				}
 			}
@@ -35,7 +34,7 @@ func (r *GSReaderLowMem) Lookup(domain string) ([]string, error) {
 	}
 
 	gcCounter := 0
-	v2site, err := LoadV2SiteFromFile(r.File)
+	v2site, err := r.loadV2Site()
 	if err == nil {
 		defer v2site.Close()
 		sitecodes := v2site.Codes()
@@ -81,19 +80,28 @@ func (r *GSReaderLowMem) Lookup(domain string) ([]string, error) {
 }
 
 func (r *GSReaderLowMem) Extract(wantList map[string][]string, regex bool) ([]string, error) {
-	var geositeList []GeoSite
+	items, err := r.extractItems(wantList, regex, false)
+	if err != nil {
+		return nil, err
+	}
+	return itemValues(items), nil
+}
+
+// extract rule items of the wanted codes, keyword rules are always included
+func (r *GSReaderLowMem) ExtractItems(wantList map[string][]string, regex bool) ([]Item, error) {
+	return r.extractItems(wantList, regex, true)
+}
+
+func (r *GSReaderLowMem) extractItems(wantList map[string][]string, regex bool, keyword bool) ([]Item, error) {
+	var geositeList []*GeoSite
 	// try sing-box geosite
-	geoReader, codes, err := LoadSingSiteFromFile(r.File)
+	geoReader, codes, err := r.loadSingSite()
 	if err == nil && len(codes) > 0 {
-		domains, _, err := r.extractSingGeoSite(geoReader, codes, wantList, regex, false)
-		if err == nil {
-			domains = common.Uniq(domains)
-			sort.Strings(domains)
-		}
-		return domains, err
+		_, itemlist, err := r.extractSingGeoSite(geoReader, codes, wantList, regex, keyword)
+		return itemlist, err
 	}
 
-	v2site, err := LoadV2SiteFromFile(r.File)
+	v2site, err := r.loadV2Site()
 	codes = []string{}
 	for key := range wantList {
 		codes = append(codes, key)
@@ -104,42 +112,32 @@ func (r *GSReaderLowMem) Extract(wantList map[string][]string, regex bool) ([]st
 		if err != nil {
 			return nil, err
 		}
-		domains, _, err := r.extractV2GeoSite(geositeList, wantList, regex, false)
-		if err == nil {
-			domains = common.Uniq(domains)
-			sort.Strings(domains)
-		}
-		return domains, err
+		_, itemlist, err := r.extractV2GeoSite(geositeList, wantList, regex, keyword)
+		return itemlist, err
 	}
-
 	return nil, fmt.Errorf("Extract failed: %s", err.Error())
 }
 
 func (r *GSReaderLowMem) ToGeosite(wantList map[string][]string) (*GeoSiteList, error) {
-	codeList := make(map[string][]string)
-	for c := range wantList {
-		// remove duplicate codes, remove attributes
-		sn := strings.SplitN(c, "@", 2)
-		if _, ok := codeList[sn[0]]; !ok {
-			codeList[sn[0]] = nil
-		}
-	}
+	codeList := toGeositeWant(wantList)
 	geolist := new(GeoSiteList)
 	// sing-box geosite
-	geoReader, codes, err := LoadSingSiteFromFile(r.File)
+	geoReader, codes, err := r.loadSingSite()
 	if err == nil && len(codes) > 0 {
 		for _, code := range codes {
-			if _, ok := codeList[strings.ToUpper(code)]; !ok {
-				continue // skip unwanted codes
+			attrs, ok := codeList[strings.ToUpper(code)]
+			if !ok || geoReader.isAttrCode(code) {
+				continue // skip unwanted codes, attributes are restored into their base codes
 			}
 			tmpList := make(map[string][]string)
-			tmpList[code] = nil // the value never gets read
+			tmpList[code] = attrs
 			_, itemlist, err := r.extractSingGeoSite(geoReader, codes, tmpList, true, true)
-			if err == nil {
+			// codes left empty by the attribute filters are skipped
+			if err == nil && len(itemlist) > 0 {
 				// convert Item to geosite
 				gs := &GeoSite{
 					CountryCode: strings.ToUpper(code), // v2ray expects an uppercased country code
-					Domain:      singItemToV2(itemlist),
+					Domain:      SingItemToV2(itemlist),
 				}
 				geolist.Entry = append(geolist.Entry, gs)
 			}
@@ -151,10 +149,10 @@ func (r *GSReaderLowMem) ToGeosite(wantList map[string][]string) (*GeoSiteList,
 		return geolist, nil
 	}
 
-	var geositeList []GeoSite
-	v2site, err := LoadV2SiteFromFile(r.File)
+	var geositeList []*GeoSite
+	v2site, err := r.loadV2Site()
 	codes = []string{}
-	for key := range wantList {
+	for key := range codeList {
 		codes = append(codes, key)
 	}
 	if err == nil {
@@ -163,8 +161,11 @@ func (r *GSReaderLowMem) ToGeosite(wantList map[string][]string) (*GeoSiteList,
 		if err != nil {
 			return nil, err
 		}
-		for i := 0; i < len(geositeList); i++ {
-			geolist.Entry = append(geolist.Entry, &geositeList[i])
+		for _, site := range geositeList {
+			site.Domain = filterDomains(site.Domain, codeList[strings.ToUpper(site.CountryCode)])
+			if len(site.Domain) > 0 {
+				geolist.Entry = append(geolist.Entry, site)
+			}
 		}
 		// Sort protoList so the marshaled list is reproducible
 		sort.SliceStable(geolist.Entry, func(i, j int) bool {
@@ -177,9 +178,9 @@ func (r *GSReaderLowMem) ToGeosite(wantList map[string][]string) (*GeoSiteList,
 
 // to the ruleset json format of sing-box 1.20+
 func (r *GSReaderLowMem) ToRuleSet(wantList map[string][]string, regex bool) (*srs.PlainRuleSetCompat, error) {
-	var geositeList []GeoSite
+	var geositeList []*GeoSite
 	// try sing-box geosite
-	geoReader, codes, err := LoadSingSiteFromFile(r.File)
+	geoReader, codes, err := r.loadSingSite()
 	if err == nil && len(codes) > 0 {
 		_, itemlist, err := r.extractSingGeoSite(geoReader, codes, wantList, regex, false)
 		if len(itemlist) == 0 {
@@ -191,7 +192,7 @@ func (r *GSReaderLowMem) ToRuleSet(wantList map[string][]string, regex bool) (*s
 		return nil, err
 	}
 
-	v2site, err := LoadV2SiteFromFile(r.File)
+	v2site, err := r.loadV2Site()
 	codes = []string{}
 	for key := range wantList {
 		codes = append(codes, key)
@@ -213,35 +214,3 @@ func (r *GSReaderLowMem) ToRuleSet(wantList map[string][]string, regex bool) (*s
 	}
 	return nil, fmt.Errorf("Convert to ruleset failed: %s", err.Error())
 }
-
-func (r *GSReaderLowMem) ToQuantumultX(wantList map[string][]string) ([]string, error) {
-	var geositeList []GeoSite
-	// try sing-box geosite
-	geoReader, codes, err := LoadSingSiteFromFile(r.File)
-	if err == nil && len(codes) > 0 {
-		_, itemlist, err := r.extractSingGeoSite(geoReader, codes, wantList, false, false)
-		if err == nil {
-			return itemToQxRule(itemlist)
-		}
-		return nil, err
-	}
-
-	v2site, err := LoadV2SiteFromFile(r.File)
-	codes = []string{}
-	for key := range wantList {
-		codes = append(codes, key)
-	}
-	if err == nil {
-		defer v2site.Close()
-		geositeList, err = v2site.ReadSites(codes, r.MustExist)
-		if err != nil {
-			return nil, err
-		}
-		_, itemlist, err := r.extractV2GeoSite(geositeList, wantList, false, true)
-		if err == nil {
-			return itemToQxRule(itemlist)
-		}
-		return nil, err
-	}
-	return nil, fmt.Errorf("Convert to QuantumultX failed: %s", err.Error())
-}
@@ -3,6 +3,7 @@ package geosite
 import (
 	"errors"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"sort"
@@ -11,6 +12,7 @@ import (
 	"github.com/snowie2000/geoview/strmatcher"
 
 	"github.com/sagernet/sing/common"
+	"github.com/snowie2000/geoview/protohelper"
 	"github.com/snowie2000/geoview/srs"
 )
 
@@ -27,27 +29,154 @@ const (
 
 type GSHandler interface {
 	Lookup(domain string) ([]string, error)
+	NewMatcher() (*Matcher, error)
 	Extract(wantList map[string][]string, regex bool) ([]string, error)
+	ExtractItems(wantList map[string][]string, regex bool) ([]Item, error)
 	ToGeosite(wantList map[string][]string) (*GeoSiteList, error)
 	ToRuleSet(wantList map[string][]string, regex bool) (*srs.PlainRuleSetCompat, error)
-	ToQuantumultX(wantList map[string][]string) ([]string, error)
+	Codes() ([]string, error)
 }
 
 func NewGeositeHandler(filename string, mustexist bool, lowmem bool) GSHandler {
 	if lowmem {
-		return &GSReaderLowMem{GSReader{filename, mustexist}}
+		return &GSReaderLowMem{GSReader{File: filename, MustExist: mustexist}}
 	} else {
-		return &GSReader{filename, mustexist}
+		return &GSReader{File: filename, MustExist: mustexist}
 	}
 }
 
+// handler of a geosite read from a reader instead of a file
+func NewGeositeHandlerFromReader(reader io.ReaderAt, size int64, mustexist bool, lowmem bool) GSHandler {
+	r := GSReader{MustExist: mustexist, Reader: reader, Size: size}
+	if lowmem {
+		return &GSReaderLowMem{r}
+	}
+	return &r
+}
+
 type GSReader struct {
 	File      string
 	MustExist bool
+	// Reader is read instead of File if set, Size is its length
+	Reader io.ReaderAt
+	Size   int64
+}
+
+// open the geosite file, or the reader if set
+func (r *GSReader) open() (io.ReadSeekCloser, error) {
+	if r.Reader != nil {
+		return &protohelper.NopReadSeekCloser{ReadSeeker: io.NewSectionReader(r.Reader, 0, r.Size)}, nil
+	}
+	return os.Open(r.File)
+}
+
+func (r *GSReader) readAll() ([]byte, error) {
+	if r.Reader != nil {
+		return io.ReadAll(io.NewSectionReader(r.Reader, 0, r.Size))
+	}
+	return os.ReadFile(r.File)
+}
+
+func (r *GSReader) loadSingSite() (*GeoSiteReader, []string, error) {
+	reader, err := r.open()
+	if err != nil {
+		return nil, nil, err
+	}
+	return loadSingSiteFrom(reader)
+}
+
+func (r *GSReader) loadV2Site() (*V2Site, error) {
+	reader, err := r.open()
+	if err != nil {
+		return nil, err
+	}
+	return loadV2SiteFrom(reader), nil
+}
+
+// list all codes of the database uppercased, attribute codes of sing-box geosite are left out
+func (r *GSReader) Codes() ([]string, error) {
+	var codes []string
+	if geoReader, singCodes, err := r.loadSingSite(); err == nil && len(singCodes) > 0 {
+		defer common.Close(geoReader.reader)
+		for _, code := range singCodes {
+			if !geoReader.isAttrCode(code) {
+				codes = append(codes, strings.ToUpper(code))
+			}
+		}
+	} else {
+		v2site, err := r.loadV2Site()
+		if err != nil {
+			return nil, err
+		}
+		defer v2site.Close()
+		codes = v2site.Codes()
+	}
+	sort.Strings(codes)
+	return codes, nil
 }
 
-func (r *GSReader) extractV2GeoSite(geositeList []GeoSite, want map[string][]string, regex bool, keyword bool) (list []string, itemlist []Item, err error) {
-	match := false
+// check if the item passes all attribute filters. a filter is a "|" separated
+// list of attributes of which any is required, "!attr" requires the attribute
+// to be absent, e.g. "cn|ads" or "!cn"
+func hasAttrs(it Item, filters []string) bool {
+	for _, filter := range filters {
+		if !matchAttrFilter(it.Attr, filter) {
+			return false
+		}
+	}
+	return true
+}
+
+func matchAttrFilter(attrs map[string]struct{}, filter string) bool {
+	for _, attr := range strings.Split(filter, "|") {
+		attr, negated := strings.CutPrefix(attr, "!")
+		if _, ok := attrs[attr]; ok != negated {
+			return true
+		}
+	}
+	return false
+}
+
+// keep the domains passing all attribute filters
+func filterDomains(domains []*Domain, filters []string) []*Domain {
+	if len(filters) == 0 {
+		return domains
+	}
+	list := []*Domain{}
+	for _, domain := range domains {
+		it := Item{Attr: make(map[string]struct{})}
+		for _, attr := range domain.Attribute {
+			it.Attr[attr.Key] = struct{}{}
+		}
+		if hasAttrs(it, filters) {
+			list = append(list, domain)
+		}
+	}
+	return list
+}
+
+// the wanted codes of database output, attributes of "code@attr" are filters of the code
+func toGeositeWant(wantList map[string][]string) map[string][]string {
+	codeList := make(map[string][]string)
+	for c, attrs := range wantList {
+		code, codeAttrs := ParseCode(c)
+		codeList[code] = append(codeList[code], append(codeAttrs, attrs...)...)
+	}
+	return codeList
+}
+
+// the sorted and deduplicated values of the items
+func itemValues(items []Item) []string {
+	domains := make([]string, 0, len(items))
+	for _, it := range items {
+		domains = append(domains, it.Value)
+	}
+	domains = common.Uniq(domains)
+	sort.Strings(domains)
+	return domains
+}
+
+func (r *GSReader) extractV2GeoSite(geositeList []*GeoSite, want map[string][]string, regex bool, keyword bool) (list []string, itemlist []Item, err error) {
 	for _, site := range geositeList {
 		if v, ok := want[strings.ToUpper(site.CountryCode)]; !ok {
 			log.Println(site.CountryCode, "not found", v)
@@ -69,19 +198,8 @@ func (r *GSReader) extractV2GeoSite(geositeList []GeoSite, want map[string][]str
 				case RuleTypeDomain:
 					fallthrough
 				case RuleTypeDomainSuffix:
-					// check attr
-					match = true
-					for _, attr := range v {
-						if it.Attr == nil {
-							match = false
-							break
-						}
-						if _, ok := it.Attr[attr]; !ok {
-							match = false
-							break // ignore domains with wrong attributes
-						}
-					}
-					if match {
+					// ignore domains with wrong attributes
+					if hasAttrs(it, v) {
 						list = append(list, it.Value)
 						itemlist = append(itemlist, it)
 					}
@@ -93,10 +211,13 @@ func (r *GSReader) extractV2GeoSite(geositeList []GeoSite, want map[string][]str
 }
 
 func (r *GSReader) extractSingGeoSite(geoReader *GeoSiteReader, codes []string, wantList map[string][]string, regex bool, keyword bool) (list []string, itemlist []Item, err error) {
-	for code, _ := range wantList {
+	for code, attrs := range wantList {
 		// singbox rulec codes are always lowercased
-		if item, err := geoReader.Read(strings.ToLower(code)); err == nil {
+		if item, err := geoReader.ReadWithAttr(strings.ToLower(code)); err == nil {
 			for _, it := range item {
+				if !hasAttrs(it, attrs) {
+					continue
+				}
 				switch it.Type {
 				case RuleTypeDomainRegex:
 					if !regex {
@@ -161,7 +282,7 @@ func (r *GSReader) matchSiteAgainstList(domains []*Domain, domain string) (bool,
 
 // search for a domain in all geosite sites and return matched site codes
 func (r *GSReader) Lookup(domain string) ([]string, error) {
-	fileContent, err := os.ReadFile(r.File)
+	fileContent, err := r.readAll()
 	if err != nil {
 		return nil, err
 	}
@@ -175,7 +296,7 @@ func (r *GSReader) Lookup(domain string) ([]string, error) {
 				code: nil,
 			}
 			if _, items, err := r.extractSingGeoSite(geoReader, []string{code}, wantList, true, true); err == nil {
-				if ok, _ := r.matchSiteAgainstList(singItemToV2(items), domain); ok {
+				if ok, _ := r.matchSiteAgainstList(SingItemToV2(items), domain); ok {
 					matchedList = append(matchedList, code)
 				}
 			}
@@ -221,21 +342,30 @@ func (r *GSReader) Lookup(domain string) ([]string, error) {
 }
 
 func (r *GSReader) Extract(wantList map[string][]string, regex bool) ([]string, error) {
-	fileContent, err := os.ReadFile(r.File)
+	items, err := r.extractItems(wantList, regex, false)
+	if err != nil {
+		return nil, err
+	}
+	return itemValues(items), nil
+}
+
+// extract rule items of the wanted codes, keyword rules are always included
+func (r *GSReader) ExtractItems(wantList map[string][]string, regex bool) ([]Item, error) {
+	return r.extractItems(wantList, regex, true)
+}
+
+func (r *GSReader) extractItems(wantList map[string][]string, regex bool, keyword bool) ([]Item, error) {
+	fileContent, err := r.readAll()
 	if err != nil {
 		return nil, err
 	}
 
-	var geositeList []GeoSite
+	var geositeList []*GeoSite
 	// try sing-box geosite
 	geoReader, codes, err := LoadSingSite(fileContent)
 	if err == nil && len(codes) > 0 {
-		domains, _, err := r.extractSingGeoSite(geoReader, codes, wantList, regex, false)
-		if err == nil {
-			domains = common.Uniq(domains)
-			sort.Strings(domains)
-		}
-		return domains, err
+		_, itemlist, err := r.extractSingGeoSite(geoReader, codes, wantList, regex, keyword)
+		return itemlist, err
 	}
 
 	v2site, err := LoadV2Site(fileContent)
@@ -245,49 +375,40 @@ func (r *GSReader) Extract(wantList map[string][]string, regex bool) ([]string,
 	}
 	if err == nil {
 		geositeList, err = v2site.ReadSites(codes, r.MustExist)
-	}
-	if err == nil {
-		defer v2site.Close()
-		domains, _, err := r.extractV2GeoSite(geositeList, wantList, regex, false)
-		if err == nil {
-			domains = common.Uniq(domains)
-			sort.Strings(domains)
+		if err != nil {
+			return nil, err
 		}
-		return domains, err
+		defer v2site.Close()
+		_, itemlist, err := r.extractV2GeoSite(geositeList, wantList, regex, keyword)
+		return itemlist, err
 	}
-
 	return nil, fmt.Errorf("Extract failed: %s", err.Error())
 }
 
 func (r *GSReader) ToGeosite(wantList map[string][]string) (*GeoSiteList, error) {
-	fileContent, err := os.ReadFile(r.File)
+	fileContent, err := r.readAll()
 	if err != nil {
 		return nil, err
 	}
-	codeList := make(map[string][]string)
-	for c := range wantList {
-		// remove duplicate codes, remove attributes
-		sn := strings.SplitN(c, "@", 2)
-		if _, ok := codeList[sn[0]]; !ok {
-			codeList[sn[0]] = nil
-		}
-	}
+	codeList := toGeositeWant(wantList)
 	geolist := new(GeoSiteList)
 	// sing-box geosite
 	geoReader, codes, err := LoadSingSite(fileContent)
 	if err == nil && len(codes) > 0 {
 		for _, code := range codes {
-			if _, ok := codeList[strings.ToUpper(code)]; !ok {
-				continue // skip unwanted codes
+			attrs, ok := codeList[strings.ToUpper(code)]
+			if !ok || geoReader.isAttrCode(code) {
+				continue // skip unwanted codes, attributes are restored into their base codes
 			}
 			tmpList := make(map[string][]string)
-			tmpList[code] = nil // the value never gets read
+			tmpList[code] = attrs
 			_, itemlist, err := r.extractSingGeoSite(geoReader, codes, tmpList, true, true)
-			if err == nil {
+			// codes left empty by the attribute filters are skipped
+			if err == nil && len(itemlist) > 0 {
 				// convert Item to geosite
 				gs := &GeoSite{
 					CountryCode: strings.ToUpper(code), // v2ray expects an uppercased country code
-					Domain:      singItemToV2(itemlist),
+					Domain:      SingItemToV2(itemlist),
 				}
 				geolist.Entry = append(geolist.Entry, gs)
 			}
@@ -299,10 +420,10 @@ func (r *GSReader) ToGeosite(wantList map[string][]string) (*GeoSiteList, error)
 		return geolist, nil
 	}
 
-	var geositeList []GeoSite
+	var geositeList []*GeoSite
 	v2site, err := LoadV2Site(fileContent)
 	codes = []string{}
-	for key := range wantList {
+	for key := range codeList {
 		codes = append(codes, key)
 	}
 	if err == nil {
@@ -311,8 +432,11 @@ func (r *GSReader) ToGeosite(wantList map[string][]string) (*GeoSiteList, error)
 			return nil, err
 		}
 		defer v2site.Close()
-		for i := 0; i < len(geositeList); i++ {
-			geolist.Entry = append(geolist.Entry, &geositeList[i])
+		for _, site := range geositeList {
+			site.Domain = filterDomains(site.Domain, codeList[strings.ToUpper(site.CountryCode)])
+			if len(site.Domain) > 0 {
+				geolist.Entry = append(geolist.Entry, site)
+			}
 		}
 		// Sort protoList so the marshaled list is reproducible
 		sort.SliceStable(geolist.Entry, func(i, j int) bool {
@@ -325,12 +449,12 @@ func (r *GSReader) ToGeosite(wantList map[string][]string) (*GeoSiteList, error)
 
 // to the ruleset json format of sing-box 1.20+
 func (r *GSReader) ToRuleSet(wantList map[string][]string, regex bool) (*srs.PlainRuleSetCompat, error) {
-	fileContent, err := os.ReadFile(r.File)
+	fileContent, err := r.readAll()
 	if err != nil {
 		return nil, err
 	}
 
-	var geositeList []GeoSite
+	var geositeList []*GeoSite
 	// try sing-box geosite
 	geoReader, codes, err := LoadSingSite(fileContent)
 	if err == nil && len(codes) > 0 {
@@ -367,59 +491,37 @@ func (r *GSReader) ToRuleSet(wantList map[string][]string, regex bool) (*srs.Pla
 	return nil, fmt.Errorf("Convert to ruleset failed: %s", err.Error())
 }
 
-func (r *GSReader) ToQuantumultX(wantList map[string][]string) ([]string, error) {
-	fileContent, err := os.ReadFile(r.File)
-	if err != nil {
-		return nil, err
-	}
-	var geositeList []GeoSite
-	// try sing-box geosite
-	geoReader, codes, err := LoadSingSite(fileContent)
-	if err == nil && len(codes) > 0 {
-		_, itemlist, err := r.extractSingGeoSite(geoReader, codes, wantList, false, false)
-		if err == nil {
-			return itemToQxRule(itemlist)
-		}
-		return nil, err
-	}
-
-	v2site, err := LoadV2Site(fileContent)
-	codes = []string{}
-	for key := range wantList {
-		codes = append(codes, key)
-	}
-	if err == nil {
-		geositeList, err = v2site.ReadSites(codes, r.MustExist)
-		if err != nil {
-			return nil, err
-		}
-		defer v2site.Close()
-		_, itemlist, err := r.extractV2GeoSite(geositeList, wantList, false, true)
-		if err == nil {
-			return itemToQxRule(itemlist)
-		}
-		return nil, err
-	}
-	return nil, fmt.Errorf("Convert to QuantumultX failed: %s", err.Error())
-}
-
-func itemToQxRule(itemlist []Item) ([]string, error) {
+// convert items into clash rule-provider payload of the given behavior,
+// rules the behavior can't express are skipped
+func ItemToClashRule(itemlist []Item, behavior string) ([]string, error) {
 	list := []string{}
-	for _, it := range itemlist {
-		switch it.Type {
-		case RuleTypeDomain:
-			{
-				list = append(list, fmt.Sprintf("host,%s,Proxy", it.Value))
-			}
-		case RuleTypeDomainSuffix:
-			{
-				list = append(list, fmt.Sprintf("host-suffix,%s,Proxy", it.Value))
+	switch behavior {
+	case "classical":
+		for _, it := range itemlist {
+			switch it.Type {
+			case RuleTypeDomain:
+				list = append(list, "DOMAIN,"+it.Value)
+			case RuleTypeDomainSuffix:
+				list = append(list, "DOMAIN-SUFFIX,"+it.Value)
+			case RuleTypeDomainKeyword:
+				list = append(list, "DOMAIN-KEYWORD,"+it.Value)
+			case RuleTypeDomainRegex:
+				list = append(list, "DOMAIN-REGEX,"+it.Value)
 			}
-		case RuleTypeDomainKeyword:
-			{
-				list = append(list, fmt.Sprintf("host-keyword,%s,Proxy", it.Value))
+		}
+	case "domain":
+		for _, it := range itemlist {
+			switch it.Type {
+			case RuleTypeDomain:
+				list = append(list, it.Value)
+			case RuleTypeDomainSuffix:
+				list = append(list, "+."+it.Value)
 			}
 		}
+	case "ipcidr":
+		// no domain rules in ipcidr providers
+	default:
+		return nil, fmt.Errorf("unknown clash behavior: %s", behavior)
 	}
 	return list, nil
 }
@@ -449,11 +551,22 @@ func itemToRuleset(itemlist []Item) (*srs.PlainRuleSetCompat, error) {
 	return ruleset, nil
 }
 
-func singItemToV2(singItem []Item) []*Domain {
+func SingItemToV2(singItem []Item) []*Domain {
 	list := []*Domain{}
 	for _, item := range singItem {
 		d := &Domain{}
 		d.Value = item.Value
+		attrs := make([]string, 0, len(item.Attr))
+		for attr := range item.Attr {
+			attrs = append(attrs, attr)
+		}
+		sort.Strings(attrs)
+		for _, attr := range attrs {
+			d.Attribute = append(d.Attribute, &Domain_Attribute{
+				Key:        attr,
+				TypedValue: &Domain_Attribute_BoolValue{BoolValue: true},
+			})
+		}
 		switch item.Type {
 		case RuleTypeDomain:
 			d.Type = Domain_Full
@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"io"
 	"os"
+	"sort"
+	"strings"
 	"sync/atomic"
 
 	"github.com/sagernet/sing/common"
@@ -45,6 +47,10 @@ func LoadSingSiteFromFile(path string) (*GeoSiteReader, []string, error) {
 	if err != nil {
 		return nil, nil, err
 	}
+	return loadSingSiteFrom(content)
+}
+
+func loadSingSiteFrom(content io.ReadSeekCloser) (*GeoSiteReader, []string, error) {
 	reader := &GeoSiteReader{
 		reader: content,
 	}
@@ -137,6 +143,169 @@ func (r *GeoSiteReader) Read(code string) ([]Item, error) {
 	return domain, err
 }
 
+// sing-box stores the domains of each attribute as a separate code such as
+// "apple@cn", list the attributes of a code
+func (r *GeoSiteReader) attributes(code string) []string {
+	var attrs []string
+	for key := range r.domainIndex {
+		if attr, ok := strings.CutPrefix(key, code+"@"); ok {
+			attrs = append(attrs, attr)
+		}
+	}
+	sort.Strings(attrs)
+	return attrs
+}
+
+// read the items of a code, with attributes restored from its "code@attr" codes
+func (r *GeoSiteReader) ReadWithAttr(code string) ([]Item, error) {
+	items, err := r.Read(code)
+	if err != nil {
+		return nil, err
+	}
+	for _, attr := range r.attributes(code) {
+		attrItems, err := r.Read(code + "@" + attr)
+		if err != nil {
+			return nil, err
+		}
+		set := make(map[itemKey]struct{}, len(attrItems))
+		for _, it := range attrItems {
+			set[keyOf(it)] = struct{}{}
+		}
+		for i := range items {
+			if _, ok := set[keyOf(items[i])]; !ok {
+				continue
+			}
+			if items[i].Attr == nil {
+				items[i].Attr = make(map[string]struct{})
+			}
+			items[i].Attr[attr] = struct{}{}
+		}
+	}
+	return items, nil
+}
+
+// an attribute code is derived from its base code, e.g. "apple@cn" from "apple"
+func (r *GeoSiteReader) isAttrCode(code string) bool {
+	base, _, found := strings.Cut(code, "@")
+	if !found {
+		return false
+	}
+	_, exists := r.domainIndex[base]
+	return exists
+}
+
+// write v2ray geosite entries into the sing-box geosite format, domains with
+// attributes are also written into "code@attr" codes as sing-box does
+func WriteSingSite(writer io.Writer, list *GeoSiteList) error {
+	domains := make(map[string][]Item)
+	for _, site := range list.Entry {
+		// sing-box codes are always lowercased
+		code := strings.ToLower(site.CountryCode)
+		domains[code] = uniqItems(append(domains[code], v2ItemToSingSite(site.Domain)...))
+		groups := make(map[string][]*Domain)
+		for _, domain := range site.Domain {
+			for _, attr := range domain.Attribute {
+				groups[attr.Key] = append(groups[attr.Key], domain)
+			}
+		}
+		for attr, group := range groups {
+			attrCode := code + "@" + strings.ToLower(attr)
+			domains[attrCode] = uniqItems(append(domains[attrCode], v2ItemToSingSite(group)...))
+		}
+	}
+	return writeSite(writer, domains)
+}
+
+// items are compared by type and value, attributes are ignored
+type itemKey struct {
+	Type  ItemType
+	Value string
+}
+
+func keyOf(item Item) itemKey {
+	return itemKey{item.Type, item.Value}
+}
+
+// remove duplicate items, attributes are ignored
+func uniqItems(items []Item) []Item {
+	seen := make(map[itemKey]struct{}, len(items))
+	list := items[:0]
+	for _, item := range items {
+		key := keyOf(item)
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+		list = append(list, item)
+	}
+	return list
+}
+
+// a root domain of v2ray matches itself and all its subdomains, sing-box needs
+// a full domain item plus a suffix item with a leading dot for the same effect
+func v2ItemToSingSite(v2Item []*Domain) []Item {
+	items := []Item{}
+	for _, domain := range v2Item {
+		switch domain.Type {
+		case Domain_Plain:
+			items = append(items, Item{Type: RuleTypeDomainKeyword, Value: domain.Value})
+		case Domain_Regex:
+			items = append(items, Item{Type: RuleTypeDomainRegex, Value: domain.Value})
+		case Domain_Domain:
+			if strings.Contains(domain.Value, ".") {
+				items = append(items, Item{Type: RuleTypeDomain, Value: domain.Value})
+			}
+			items = append(items, Item{Type: RuleTypeDomainSuffix, Value: "." + domain.Value})
+		case Domain_Full:
+			items = append(items, Item{Type: RuleTypeDomain, Value: domain.Value})
+		}
+	}
+	return items
+}
+
+func writeSite(writer io.Writer, domains map[string][]Item) error {
+	keys := make([]string, 0, len(domains))
+	for code := range domains {
+		keys = append(keys, code)
+	}
+	// sort codes so the generated file is reproducible
+	sort.Strings(keys)
+
+	content := &bytes.Buffer{}
+	index := make(map[string]int)
+	for _, code := range keys {
+		index[code] = content.Len()
+		for _, item := range domains[code] {
+			if err := rw.WriteByte(content, item.Type); err != nil {
+				return err
+			}
+			if err := rw.WriteVString(content, item.Value); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := rw.WriteByte(writer, 0); err != nil {
+		return err
+	}
+	if err := rw.WriteUVariant(writer, uint64(len(keys))); err != nil {
+		return err
+	}
+	for _, code := range keys {
+		if err := rw.WriteVString(writer, code); err != nil {
+			return err
+		}
+		if err := rw.WriteUVariant(writer, uint64(index[code])); err != nil {
+			return err
+		}
+		if err := rw.WriteUVariant(writer, uint64(len(domains[code]))); err != nil {
+			return err
+		}
+	}
+	_, err := writer.Write(content.Bytes())
+	return err
+}
+
 type ReadCounter struct {
 	io.Reader
 	count int64
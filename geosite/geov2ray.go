@@ -7,6 +7,7 @@ import (
 	"io"
 	"os"
 
+	"github.com/sagernet/sing/common"
 	"google.golang.org/protobuf/proto"
 )
 
@@ -26,24 +27,27 @@ func (v *V2Site) Codes() (list []string) {
 	return list
 }
 
-func (v *V2Site) ReadSites(codes []string, exitOnError bool) ([]GeoSite, error) {
-	var geosite GeoSite
-	var geositeList []GeoSite
+func (v *V2Site) ReadSites(codes []string, exitOnError bool) ([]*GeoSite, error) {
+	var geositeList []*GeoSite
 
 	for _, code := range codes {
-		if index, ok := v.codeList[code]; !ok && exitOnError {
-			return nil, fmt.Errorf("%s doesn't exist", code)
-		} else {
-			v.reader.Seek(index.Offset, io.SeekStart)
-			buffer := make([]byte, index.Size)
-			if _, err := io.ReadFull(v.reader, buffer); err != nil {
-				return nil, err
+		index, ok := v.codeList[code]
+		if !ok {
+			if exitOnError {
+				return nil, fmt.Errorf("%s doesn't exist", code)
 			}
-			if err := proto.Unmarshal(buffer, &geosite); err != nil {
-				return nil, err
-			}
-			geositeList = append(geositeList, geosite)
+			continue
+		}
+		v.reader.Seek(index.Offset, io.SeekStart)
+		buffer := make([]byte, index.Size)
+		if _, err := io.ReadFull(v.reader, buffer); err != nil {
+			return nil, err
 		}
+		geosite := new(GeoSite)
+		if err := proto.Unmarshal(buffer, geosite); err != nil {
+			return nil, err
+		}
+		geositeList = append(geositeList, geosite)
 	}
 	return geositeList, nil
 }
@@ -54,7 +58,7 @@ func LoadV2Site(geositeBytes []byte) (*V2Site, error) {
 	reader.Seek(0, io.SeekStart)
 	return &V2Site{
 		codeList: list,
-		reader:   &protohelper.NopReadSeekCloser{reader},
+		reader:   &protohelper.NopReadSeekCloser{ReadSeeker: reader},
 	}, nil
 }
 
@@ -63,11 +67,42 @@ func LoadV2SiteFromFile(filename string) (*V2Site, error) {
 	if err != nil {
 		return nil, err
 	}
+	return loadV2SiteFrom(reader), nil
+}
 
+func loadV2SiteFrom(reader io.ReadSeekCloser) *V2Site {
 	list := protohelper.CodeListByReader(reader)
 	reader.Seek(0, io.SeekStart)
 	return &V2Site{
 		codeList: list,
 		reader:   reader,
-	}, nil
+	}
+}
+
+// report whether the file is a geosite database of sing-box or v2ray
+func IsGeosite(path string) bool {
+	if geoReader, codes, err := LoadSingSiteFromFile(path); err == nil {
+		common.Close(geoReader.reader)
+		return len(codes) > 0
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+	for _, code := range protohelper.CodeListByReader(file) {
+		buffer, err := protohelper.ReadEntry(file, code)
+		if err != nil {
+			return false
+		}
+		geosite := new(GeoSite)
+		if err := proto.Unmarshal(buffer, geosite); err != nil {
+			return false
+		}
+		// cidr of a geoip.dat are parsed into domains without value
+		if len(geosite.Domain) > 0 {
+			return geosite.Domain[0].GetValue() != ""
+		}
+	}
+	return false
 }
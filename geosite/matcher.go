@@ -0,0 +1,234 @@
+package geosite
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/sagernet/sing/common"
+	"github.com/snowie2000/geoview/strmatcher"
+)
+
+// Matcher keeps a matcher group of every code, so that a batch of domains can
+// be looked up without reading the file and building the groups again
+type Matcher struct {
+	codes   []string
+	groups  []*strmatcher.MapMatcherGroup
+	domains [][]*Domain // nil for attribute groups
+	// compiled regex rules of the kept domains
+	regexes map[*Domain]*regexp.Regexp
+}
+
+// Match is a rule which matched the lookup target
+type Match struct {
+	Code string
+	Rule string
+}
+
+func buildMatcherGroup(domains []*Domain) (*strmatcher.MapMatcherGroup, error) {
+	g := strmatcher.NewMapMatcherGroup()
+	for _, d := range domains {
+		matcherType, f := matcherTypeMap[d.Type]
+		if !f {
+			return nil, errors.New("unsupported domain type")
+		}
+		if _, err := g.AddPattern(d.Value, matcherType); err != nil {
+			return nil, err
+		}
+	}
+	g.Build()
+	return g, nil
+}
+
+func (m *Matcher) add(code string, domains []*Domain, keep bool) error {
+	g, err := buildMatcherGroup(domains)
+	if err != nil {
+		return err
+	}
+	m.codes = append(m.codes, code)
+	m.groups = append(m.groups, g)
+	if !keep {
+		domains = nil
+	}
+	for _, d := range domains {
+		if d.Type != Domain_Regex {
+			continue
+		}
+		re, err := regexp.Compile(d.Value)
+		if err != nil {
+			return err
+		}
+		if m.regexes == nil {
+			m.regexes = make(map[*Domain]*regexp.Regexp)
+		}
+		m.regexes[d] = re
+	}
+	m.domains = append(m.domains, domains)
+	return nil
+}
+
+// add a code and a "code@attr" group for each attribute of the code
+func (m *Matcher) addSite(code string, site *GeoSite) error {
+	if err := m.add(code, site.Domain, true); err != nil {
+		return err
+	}
+	groups := make(map[string][]*Domain)
+	for _, domain := range site.Domain {
+		for _, attr := range domain.Attribute {
+			groups[attr.Key] = append(groups[attr.Key], domain)
+		}
+	}
+	attrs := make([]string, 0, len(groups))
+	for attr := range groups {
+		attrs = append(attrs, attr)
+	}
+	sort.Strings(attrs)
+	for _, attr := range attrs {
+		if err := m.add(code+"@"+attr, groups[attr], false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func newSingMatcher(geoReader *GeoSiteReader, codes []string) (*Matcher, error) {
+	sort.Strings(codes)
+	m := new(Matcher)
+	for _, code := range codes {
+		// attribute codes are added along with their base codes
+		if geoReader.isAttrCode(code) {
+			continue
+		}
+		items, err := geoReader.ReadWithAttr(code)
+		if err != nil {
+			return nil, err
+		}
+		for i := range items {
+			// remove "." prefix for singbox rules
+			if items[i].Type == RuleTypeDomainSuffix {
+				items[i].Value = strings.TrimPrefix(items[i].Value, ".")
+			}
+		}
+		if err := m.addSite(code, &GeoSite{Domain: SingItemToV2(items)}); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+func newV2Matcher(v2site *V2Site) (*Matcher, error) {
+	codes := v2site.Codes()
+	sort.Strings(codes)
+	m := new(Matcher)
+	for _, code := range codes {
+		geositeList, err := v2site.ReadSites([]string{code}, true)
+		if err != nil {
+			return nil, err
+		}
+		if err := m.addSite(code, geositeList[0]); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// build matchers of all codes in the geosite file
+func (r *GSReader) NewMatcher() (*Matcher, error) {
+	fileContent, err := r.readAll()
+	if err != nil {
+		return nil, err
+	}
+	// try sing-box geosite
+	geoReader, codes, err := LoadSingSite(fileContent)
+	if err == nil && len(codes) > 0 {
+		return newSingMatcher(geoReader, codes)
+	}
+
+	v2site, err := LoadV2Site(fileContent)
+	if err == nil {
+		defer v2site.Close()
+		return newV2Matcher(v2site)
+	}
+	return nil, fmt.Errorf("Not a valid geosite format")
+}
+
+func (r *GSReaderLowMem) NewMatcher() (*Matcher, error) {
+	// try sing-box geosite
+	geoReader, codes, err := r.loadSingSite()
+	if err == nil && len(codes) > 0 {
+		defer common.Close(geoReader.reader)
+		return newSingMatcher(geoReader, codes)
+	}
+
+	v2site, err := r.loadV2Site()
+	if err == nil {
+		defer v2site.Close()
+		return newV2Matcher(v2site)
+	}
+	return nil, fmt.Errorf("Not a valid geosite format")
+}
+
+// return the codes matching the domain, "code@attr" is included if the
+// domain matches rules with the attribute
+func (m *Matcher) Match(domain string) []string {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	matchedList := []string{}
+	for i, g := range m.groups {
+		if len(g.Match(domain)) > 0 {
+			matchedList = append(matchedList, m.codes[i])
+		}
+	}
+	return matchedList
+}
+
+// return the rules matching the domain, attribute groups are not listed as the
+// attributes are part of the rules
+func (m *Matcher) Explain(domain string) []Match {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	list := []Match{}
+	for i, g := range m.groups {
+		if m.domains[i] == nil || len(g.Match(domain)) == 0 {
+			continue
+		}
+		for _, d := range m.domains[i] {
+			if m.matchDomain(d, domain) {
+				list = append(list, Match{Code: m.codes[i], Rule: DomainRule(d)})
+			}
+		}
+	}
+	return list
+}
+
+// match a single rule in the same way as strmatcher
+func (m *Matcher) matchDomain(d *Domain, domain string) bool {
+	switch d.Type {
+	case Domain_Full:
+		return domain == strings.ToLower(d.Value)
+	case Domain_Domain:
+		value := strings.ToLower(d.Value)
+		return domain == value || strings.HasSuffix(domain, "."+value)
+	case Domain_Plain:
+		return strings.Contains(domain, strings.ToLower(d.Value))
+	case Domain_Regex:
+		return m.regexes[d].MatchString(domain)
+	}
+	return false
+}
+
+var domainRulePrefix = map[Domain_Type]string{
+	Domain_Plain:  "keyword:",
+	Domain_Regex:  "regexp:",
+	Domain_Domain: "domain:",
+	Domain_Full:   "full:",
+}
+
+// format a rule in the syntax of domain-list-community, e.g. "domain:google.com @cn"
+func DomainRule(d *Domain) string {
+	rule := domainRulePrefix[d.Type] + d.Value
+	for _, attr := range d.Attribute {
+		rule += " @" + attr.Key
+	}
+	return rule
+}
@@ -0,0 +1,56 @@
+package geosite
+
+import (
+	"sort"
+	"strings"
+)
+
+// MergeGeoSite combines the lists into one, domains of the same code are united
+// without duplicates
+func MergeGeoSite(lists ...*GeoSiteList) *GeoSiteList {
+	sites := make(map[string][]*Domain)
+	for _, list := range lists {
+		for _, site := range list.Entry {
+			code := strings.ToUpper(site.CountryCode)
+			sites[code] = append(sites[code], site.Domain...)
+		}
+	}
+	geolist := new(GeoSiteList)
+	for code, domains := range sites {
+		geolist.Entry = append(geolist.Entry, &GeoSite{
+			CountryCode: code,
+			Domain:      uniqDomains(domains),
+		})
+	}
+	// Sort protoList so the marshaled list is reproducible
+	sort.SliceStable(geolist.Entry, func(i, j int) bool {
+		return geolist.Entry[i].CountryCode < geolist.Entry[j].CountryCode
+	})
+	return geolist
+}
+
+// DiffGeoSite compares two versions of a code, domains are reported in the form
+// of "domain:google.com @cn". Either of them can be nil
+func DiffGeoSite(before, after *GeoSite) (added, removed []string) {
+	beforeKeys := make(map[string]bool)
+	for _, domain := range before.GetDomain() {
+		beforeKeys[domainKey(domain)] = true
+	}
+	afterKeys := make(map[string]bool)
+	for _, domain := range after.GetDomain() {
+		afterKeys[domainKey(domain)] = true
+	}
+	for key := range afterKeys {
+		if !beforeKeys[key] {
+			added = append(added, key)
+		}
+	}
+	for key := range beforeKeys {
+		if !afterKeys[key] {
+			removed = append(removed, key)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	return added, removed
+}
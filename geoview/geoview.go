@@ -0,0 +1,415 @@
+// Package geoview extracts and converts geoip, geosite and sing-box rule-set
+// databases without going through the command line. Databases are read from an
+// io.ReaderAt, such as an *os.File or a *bytes.Reader, along with its size.
+package geoview
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/snowie2000/geoview/codeset"
+	"github.com/snowie2000/geoview/geoip"
+	"github.com/snowie2000/geoview/geosite"
+	"github.com/snowie2000/geoview/mrs"
+	"github.com/snowie2000/geoview/rulelist"
+	"github.com/snowie2000/geoview/ruleset"
+	"github.com/snowie2000/geoview/srs"
+	"google.golang.org/protobuf/proto"
+)
+
+// database types
+const (
+	TypeGeoIP   = "geoip"
+	TypeGeosite = "geosite"
+	TypeRuleSet = "ruleset"
+)
+
+// Options of extraction, the same as the flags of the command line
+type Options struct {
+	// database type: geoip | geosite | ruleset
+	Type string
+	// codes to extract in the syntax of -list, e.g. "cn,-private" or "google@!cn".
+	// item types are the codes of rule-sets, e.g. "domain,ip_cidr"
+	List string
+	// ip versions of the result, both are included if neither is set
+	IPv4 bool
+	IPv6 bool
+	// include regex rules of geosite
+	Regex bool
+	// merge overlapping and adjacent ip ranges of geoip
+	Merge bool
+	// output the complement of the geoip result, reverse_match is flipped for geoip output
+	Invert bool
+	// return an error if a code doesn't exist
+	Strict bool
+	// read codes one by one instead of loading the whole database
+	Lowmem bool
+}
+
+// ConvertOptions of conversion, the zero value of the rule options is the
+// default of the format
+type ConvertOptions struct {
+	Options
+	// output format, the same as -format
+	Format string
+	// policy appended to each rule of line based formats
+	Policy string
+	// options appended to each rule of line based formats, e.g. "no-resolve"
+	RuleOptions []string
+	// clash rule-provider behavior: classical | domain | ipcidr
+	Behavior string
+}
+
+func (o *Options) ipType() geoip.IPType {
+	var tp geoip.IPType
+	if o.IPv4 {
+		tp |= geoip.IPv4
+	}
+	if o.IPv6 {
+		tp |= geoip.IPv6
+	}
+	if tp == 0 {
+		tp = geoip.IPv4 | geoip.IPv6
+	}
+	return tp
+}
+
+func (o *Options) geoip(r io.ReaderAt, size int64) (*geoip.GeoIPDatIn, error) {
+	expr, err := codeset.Parse(o.List)
+	if err != nil {
+		return nil, err
+	}
+	want := make(map[string]bool)
+	for _, code := range expr.Codes() {
+		want[strings.ToUpper(code)] = true
+	}
+	return &geoip.GeoIPDatIn{
+		Want:       want,
+		MustExist:  o.Strict,
+		Expression: expr,
+		Merge:      o.Merge,
+		Invert:     o.Invert,
+		Reader:     r,
+		Size:       size,
+		Lowmem:     o.Lowmem,
+	}, nil
+}
+
+func (o *Options) geosite(r io.ReaderAt, size int64) (geosite.GSHandler, map[string][]string, error) {
+	expr, err := codeset.Parse(o.List)
+	if err != nil {
+		return nil, nil, err
+	}
+	want := make(map[string][]string)
+	for _, v := range expr.Codes() {
+		code, attrs := geosite.ParseCode(v)
+		want[code] = attrs
+	}
+	handler := geosite.NewGeositeHandlerFromReader(r, size, o.Strict, o.Lowmem)
+	if !expr.Plain() {
+		handler = geosite.NewExprHandler(handler, expr)
+	}
+	return handler, want, nil
+}
+
+func (o *Options) ruleset(r io.ReaderAt, size int64) *ruleset.RuleSetIn {
+	want := make(map[string]bool)
+	for _, v := range strings.Split(o.List, ",") {
+		want[strings.ToLower(strings.TrimSpace(v))] = true
+	}
+	return &ruleset.RuleSetIn{
+		Want:      want,
+		MustExist: o.Strict,
+		Reader:    r,
+		Size:      size,
+	}
+}
+
+// Extract the ip-cidr or domains of the codes
+func Extract(r io.ReaderAt, size int64, opts Options) ([]string, error) {
+	switch opts.Type {
+	case TypeGeoIP:
+		data, err := opts.geoip(r, size)
+		if err != nil {
+			return nil, err
+		}
+		return data.Extract(opts.ipType())
+	case TypeGeosite:
+		handler, want, err := opts.geosite(r, size)
+		if err != nil {
+			return nil, err
+		}
+		return handler.Extract(want, opts.Regex)
+	case TypeRuleSet:
+		return opts.ruleset(r, size).Extract(opts.ipType())
+	}
+	return nil, fmt.Errorf("unknown database type: %s", opts.Type)
+}
+
+// source of conversion, each database type implements the outputs it supports
+type converter interface {
+	ruleSet() (*srs.PlainRuleSetCompat, error)
+	geoSite() (*geosite.GeoSiteList, error)
+	geoIP() (*geoip.GeoIPList, error)
+	ruleList(template *rulelist.Template) ([]string, error)
+	clash(behavior string) ([]string, error)
+	defaultBehavior() string
+}
+
+var errUnsupported = errors.New("conversion is not supported")
+
+type geoipConverter struct {
+	data   *geoip.GeoIPDatIn
+	ipType geoip.IPType
+}
+
+func (c *geoipConverter) ruleSet() (*srs.PlainRuleSetCompat, error) {
+	return c.data.ToRuleSet(c.ipType)
+}
+
+func (c *geoipConverter) geoSite() (*geosite.GeoSiteList, error) {
+	return nil, errUnsupported
+}
+
+func (c *geoipConverter) geoIP() (*geoip.GeoIPList, error) {
+	return c.data.ToGeoIP()
+}
+
+func (c *geoipConverter) ruleList(template *rulelist.Template) ([]string, error) {
+	list, err := c.data.Extract(c.ipType)
+	if err != nil {
+		return nil, err
+	}
+	return template.FromCIDR(list), nil
+}
+
+func (c *geoipConverter) clash(behavior string) ([]string, error) {
+	list, err := c.data.Extract(c.ipType)
+	if err != nil {
+		return nil, err
+	}
+	return geoip.CIDRToClashRule(list, behavior)
+}
+
+func (c *geoipConverter) defaultBehavior() string {
+	return "ipcidr"
+}
+
+type geositeConverter struct {
+	handler geosite.GSHandler
+	want    map[string][]string
+	regex   bool
+}
+
+func (c *geositeConverter) ruleSet() (*srs.PlainRuleSetCompat, error) {
+	return c.handler.ToRuleSet(c.want, c.regex)
+}
+
+func (c *geositeConverter) geoSite() (*geosite.GeoSiteList, error) {
+	return c.handler.ToGeosite(c.want)
+}
+
+func (c *geositeConverter) geoIP() (*geoip.GeoIPList, error) {
+	return nil, errUnsupported
+}
+
+func (c *geositeConverter) ruleList(template *rulelist.Template) ([]string, error) {
+	items, err := c.handler.ExtractItems(c.want, false)
+	if err != nil {
+		return nil, err
+	}
+	return template.FromItems(items), nil
+}
+
+func (c *geositeConverter) clash(behavior string) ([]string, error) {
+	items, err := c.handler.ExtractItems(c.want, c.regex)
+	if err != nil {
+		return nil, err
+	}
+	return geosite.ItemToClashRule(items, behavior)
+}
+
+func (c *geositeConverter) defaultBehavior() string {
+	return "domain"
+}
+
+type rulesetConverter struct {
+	data   *ruleset.RuleSetIn
+	ipType geoip.IPType
+}
+
+func (c *rulesetConverter) ruleSet() (*srs.PlainRuleSetCompat, error) {
+	return c.data.ToRuleSet(c.ipType)
+}
+
+func (c *rulesetConverter) geoSite() (*geosite.GeoSiteList, error) {
+	return c.data.ToGeosite()
+}
+
+func (c *rulesetConverter) geoIP() (*geoip.GeoIPList, error) {
+	return c.data.ToGeoIP(c.ipType)
+}
+
+func (c *rulesetConverter) ruleList(template *rulelist.Template) ([]string, error) {
+	return c.data.ToRuleList(c.ipType, template)
+}
+
+func (c *rulesetConverter) clash(behavior string) ([]string, error) {
+	return c.data.ToClash(c.ipType, behavior)
+}
+
+func (c *rulesetConverter) defaultBehavior() string {
+	return "classical"
+}
+
+func (o *Options) converter(r io.ReaderAt, size int64) (converter, error) {
+	switch o.Type {
+	case TypeGeoIP:
+		data, err := o.geoip(r, size)
+		if err != nil {
+			return nil, err
+		}
+		return &geoipConverter{data, o.ipType()}, nil
+	case TypeGeosite:
+		handler, want, err := o.geosite(r, size)
+		if err != nil {
+			return nil, err
+		}
+		return &geositeConverter{handler, want, o.Regex}, nil
+	case TypeRuleSet:
+		return &rulesetConverter{o.ruleset(r, size), o.ipType()}, nil
+	}
+	return nil, fmt.Errorf("unknown database type: %s", o.Type)
+}
+
+// Convert the codes into the format of opts.Format and write it to w
+func Convert(w io.Writer, r io.ReaderAt, size int64, opts ConvertOptions) error {
+	c, err := opts.converter(r, size)
+	if err != nil {
+		return err
+	}
+	err = convert(w, c, &opts)
+	if errors.Is(err, errUnsupported) {
+		return fmt.Errorf("converting from %s to %s is not supported", opts.Type, opts.Format)
+	}
+	return err
+}
+
+func convert(w io.Writer, c converter, opts *ConvertOptions) error {
+	switch opts.Format {
+	case "json":
+		ruleset, err := c.ruleSet()
+		if err != nil {
+			return err
+		}
+		return json.NewEncoder(w).Encode(*ruleset)
+	case "srs", "ruleset":
+		ruleset, err := c.ruleSet()
+		if err != nil {
+			return err
+		}
+		return srs.Write(w, ruleset.Options, ruleset.Version)
+	case "mrs":
+		ruleset, err := c.ruleSet()
+		if err != nil {
+			return err
+		}
+		return WriteMrs(w, ruleset)
+	case "geosite", "singsite":
+		list, err := c.geoSite()
+		if err != nil {
+			return err
+		}
+		if opts.Format == "singsite" {
+			return geosite.WriteSingSite(w, list)
+		}
+		return writeProto(w, list)
+	case "geoip", "mmdb":
+		list, err := c.geoIP()
+		if err != nil {
+			return err
+		}
+		if opts.Format == "mmdb" {
+			return geoip.WriteMMDB(w, list)
+		}
+		return writeProto(w, list)
+	case "clash", "clash-text":
+		behavior := opts.Behavior
+		if behavior == "" {
+			behavior = c.defaultBehavior()
+		}
+		rules, err := c.clash(behavior)
+		if err != nil {
+			return err
+		}
+		if opts.Format == "clash" {
+			rules = ClashPayload(rules)
+		}
+		return writeLines(w, rules)
+	}
+	template, err := rulelist.Get(opts.Format)
+	if err != nil {
+		return fmt.Errorf("unknown format: %s", opts.Format)
+	}
+	if opts.Policy != "" {
+		template.Policy = opts.Policy
+	}
+	template.Options = append(template.Options, opts.RuleOptions...)
+	lines, err := c.ruleList(template)
+	if err != nil {
+		return err
+	}
+	return writeLines(w, lines)
+}
+
+func writeProto(w io.Writer, m proto.Message) error {
+	protoBytes, err := proto.Marshal(m)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(protoBytes)
+	return err
+}
+
+func writeLines(w io.Writer, lines []string) error {
+	for _, line := range lines {
+		if _, err := io.WriteString(w, line+"\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ClashPayload renders rules as the yaml payload of a clash rule-provider
+func ClashPayload(rules []string) []string {
+	lines := make([]string, 0, len(rules)+1)
+	lines = append(lines, "payload:")
+	for _, rule := range rules {
+		lines = append(lines, "  - '"+strings.ReplaceAll(rule, "'", "''")+"'")
+	}
+	return lines
+}
+
+// WriteMrs writes the rule-set as a mihomo rule-provider, which holds either
+// domains or ip-cidr, never both. Keyword and regex rules can't be written
+// and are reported as an error rather than dropped
+func WriteMrs(w io.Writer, ruleset *srs.PlainRuleSetCompat) error {
+	if len(ruleset.Options.Rules) == 0 {
+		return errors.New("empty rule-set")
+	}
+	rule := ruleset.Options.Rules[0].DefaultOptions
+	if n := len(rule.DomainKeyword) + len(rule.DomainRegex); n > 0 {
+		return fmt.Errorf("mrs can't hold keyword or regex rules, %d of them would be lost", n)
+	}
+	hasDomain := len(rule.Domain) > 0 || len(rule.DomainSuffix) > 0
+	if hasDomain && len(rule.IPCIDR) > 0 {
+		return errors.New("mrs can't hold both domain and ip-cidr rules")
+	}
+	if hasDomain {
+		return mrs.WriteDomain(w, rule.Domain, rule.DomainSuffix)
+	}
+	return mrs.WriteIPCIDR(w, rule.IPCIDR)
+}
@@ -2,6 +2,7 @@ package global
 
 var (
 	Input      string
+	Inputs     []string // all -input values, Input is the first one
 	Datatype   string
 	Action     string
 	Want       string
@@ -10,7 +11,16 @@ var (
 	Regex      bool
 	Output     string
 	Target     string
+	Values     string
+	Explain    bool
 	Format     string
+	Behavior   string
+	Policy     string
+	Options    string
 	Appendfile bool
+	Merge      bool
+	Invert     bool
+	IPFormat   string
 	Lowmem     bool
+	Conflict   string
 )
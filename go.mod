@@ -3,6 +3,9 @@ module github.com/snowie2000/geoview
 go 1.24.0
 
 require (
+	github.com/klauspost/compress v1.18.0
+	github.com/maxmind/mmdbwriter v1.0.0
+	github.com/oschwald/maxminddb-golang v1.13.1
 	github.com/sagernet/sing v0.7.10
 	go4.org/netipx v0.0.0-20231129151722-fdeea329fbba
 	google.golang.org/protobuf v1.36.9
@@ -2,18 +2,30 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
 	"encoding/json"
 	"flag"
 	"fmt"
+	"github.com/sagernet/sing/common"
+	"github.com/snowie2000/geoview/cidr"
+	"github.com/snowie2000/geoview/codeset"
 	"github.com/snowie2000/geoview/geoip"
 	"github.com/snowie2000/geoview/geosite"
+	"github.com/snowie2000/geoview/geoview"
 	"github.com/snowie2000/geoview/global"
 	"github.com/snowie2000/geoview/memory"
 	"github.com/snowie2000/geoview/protohelper"
+	"github.com/snowie2000/geoview/rulelist"
+	"github.com/snowie2000/geoview/ruleset"
 	"github.com/snowie2000/geoview/srs"
+	"go4.org/netipx"
 	"google.golang.org/protobuf/proto"
 	"io"
+	"net/netip"
 	"os"
+	"path/filepath"
+	"sort"
 	"strings"
 )
 
@@ -37,16 +49,25 @@ func main() {
 	memory.SetDynamicMemoryLimit(0.80)
 
 	myflag := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
-	myflag.StringVar(&global.Input, "input", "", "datafile")
-	myflag.StringVar(&global.Datatype, "type", "geoip", "datafile type: geoip | geosite")
-	myflag.StringVar(&global.Action, "action", "extract", "action: extract | convert | lookup")
+	myflag.Var(new(inputList), "input", "datafile, can be repeated or be a directory for lookup and merge to use multiple databases. the source directory for build")
+	myflag.StringVar(&global.Datatype, "type", "geoip", "datafile type: geoip | geosite | ruleset")
+	myflag.StringVar(&global.Action, "action", "extract", "action: extract | convert | lookup | build | merge | diff, build compiles the source lists of -input into a database, merge combines the databases of -input into one, diff compares two databases of -input")
 	myflag.StringVar(&global.Want, "list", "", "comma separated site or geo list, e.g. \"cn,jp\" or \"youtube,google\"")
 	myflag.BoolVar(&global.Ipv4, "ipv4", true, "enable ipv4 output")
 	myflag.BoolVar(&global.Ipv6, "ipv6", true, "enable ipv6 output")
 	myflag.BoolVar(&global.Regex, "regex", false, "allow regex rules in the geosite result")
+	myflag.StringVar(&global.IPFormat, "ipformat", "cidr", "ip format of geoip extraction: cidr | range | both, both outputs a range only if it can't be represented as a single cidr")
+	myflag.BoolVar(&global.Invert, "invert", false, "output the complement of the geoip result within the enabled ip versions, reverse_match is flipped instead for geoip database output")
+	myflag.BoolVar(&global.Explain, "explain", false, "show the rules matching the lookup target, such as the cidr containing the ip or the domain rule with its attributes")
+	myflag.BoolVar(&global.Merge, "merge", false, "merge overlapping and adjacent ip ranges of the geoip result")
 	myflag.StringVar(&global.Output, "output", "", "output to file, leave empty to print to console")
-	myflag.StringVar(&global.Target, "value", "", "ip or domain to lookup, required only for lookup action")
-	myflag.StringVar(&global.Format, "format", "ruleset", "convert output format. type: ruleset(srs) | quantumultx(qx) | json | geosite | geoip")
+	myflag.StringVar(&global.Target, "value", "", "ip, domain, cidr or ip range to lookup, required only for lookup action. \"-\" to read a list from stdin")
+	myflag.StringVar(&global.Values, "values", "", "file of ips or domains to lookup, one per line. results are tab separated, or json lines with -format json")
+	myflag.StringVar(&global.Format, "format", "ruleset", "convert output format. type: ruleset(srs) | quantumultx(qx) | json | mrs | clash | clash-text | surge | loon | shadowrocket | geosite | singsite | geoip | mmdb. build also accepts text and defaults to the database of -type. batch lookup only reads json, which writes json lines")
+	myflag.StringVar(&global.Policy, "policy", "", "policy name appended to each rule of line based formats, defaults to Proxy for quantumultx and none for others")
+	myflag.StringVar(&global.Options, "options", "", "comma separated options appended to each rule of line based formats, e.g. no-resolve")
+	myflag.StringVar(&global.Behavior, "behavior", "", "clash rule-provider behavior: classical | domain | ipcidr, defaults to domain for geosite, ipcidr for geoip and classical for ruleset")
+	myflag.StringVar(&global.Conflict, "conflict", "union", "how merge combines a code found in several inputs: union | first-wins | last-wins")
 	myflag.BoolVar(&global.Appendfile, "append", false, "append to existing file instead of overwriting")
 	myflag.BoolVar(&global.Lowmem, "lowmem", true, "low memory mode, reduce memory cost by partial file reading")
 	myflag.BoolVar(&version, "version", false, "print version")
@@ -61,11 +82,16 @@ func main() {
 	}
 
 	if global.Input == "" {
-		printErrorln("Error: Input file empty\n")
+		printErrorln("Error: Input file empty")
 		myflag.Usage()
 		return
 	}
 
+	if len(global.Inputs) > 1 && global.Action != "lookup" && global.Action != "merge" && global.Action != "diff" {
+		printErrorln("Error: multiple inputs are only supported by lookup, merge and diff")
+		return
+	}
+
 	switch global.Action {
 	case "extract":
 		if global.Want == "" {
@@ -75,18 +101,39 @@ func main() {
 		}
 	case "convert":
 		if global.Want == "" {
-			printErrorln("Error: List should not be empty\n")
+			printErrorln("Error: List should not be empty")
 			myflag.Usage()
 			return
 		}
 		convert()
 	case "lookup":
-		if global.Target == "" {
-			printErrorln("Error: Target should not be empty\n")
+		if global.Target == "" && global.Values == "" {
+			printErrorln("Error: Target should not be empty")
 			myflag.Usage()
 			return
 		}
 		lookup()
+	case "build", "merge":
+		// the database of the type is written unless another format is given
+		formatSet := false
+		myflag.Visit(func(f *flag.Flag) {
+			formatSet = formatSet || f.Name == "format"
+		})
+		if !formatSet {
+			global.Format = global.Datatype
+		}
+		if global.Output == "" && global.Format != "text" {
+			printErrorln("Error: Output file for", global.Action, "is required")
+			myflag.Usage()
+			return
+		}
+		if global.Action == "build" {
+			build()
+		} else {
+			merge()
+		}
+	case "diff":
+		diff()
 	default:
 		printErrorln("Error: unknown action:", global.Action)
 	}
@@ -95,10 +142,517 @@ func main() {
 	os.Exit(exitCode)
 }
 
+// compile source lists into a database, other formats are converted from the built database
+func build() {
+	list, codes, err := buildList()
+	if err != nil {
+		printErrorln("Error:", err)
+		return
+	}
+	outputDatabase(list, codes)
+}
+
+// output a geosite or geoip database in -format, which is either the database
+// itself or converted from it, limited to -list if given
+func outputDatabase(list proto.Message, codes []string) {
+	// otherwise the database is converted into itself to apply -list and -invert
+	if global.Format == global.Datatype && global.Want == "" && !global.Invert {
+		if err := outputProtoToFile(global.Output, list); err != nil {
+			printErrorln("Error:", err)
+		}
+		return
+	}
+
+	data, err := proto.Marshal(list)
+	if err != nil {
+		printErrorln("Error:", err)
+		return
+	}
+	opts := geoview.Options{
+		Type:   global.Datatype,
+		List:   global.Want,
+		IPv4:   global.Ipv4,
+		IPv6:   global.Ipv6,
+		Regex:  global.Regex,
+		Merge:  global.Merge,
+		Invert: global.Invert,
+		Strict: strict,
+	}
+	if opts.List == "" {
+		opts.List = strings.Join(codes, ",")
+	}
+	reader := bytes.NewReader(data)
+	if global.Format == "text" {
+		lines, err := geoview.Extract(reader, reader.Size(), opts)
+		if err != nil {
+			printErrorln("Error:", err)
+			return
+		}
+		outputLines(lines)
+		return
+	}
+	convertOpts := geoview.ConvertOptions{
+		Options:  opts,
+		Format:   global.Format,
+		Policy:   global.Policy,
+		Behavior: global.Behavior,
+	}
+	if global.Options != "" {
+		convertOpts.RuleOptions = strings.Split(global.Options, ",")
+	}
+	file, err := os.OpenFile(global.Output, os.O_WRONLY|os.O_TRUNC|os.O_CREATE, 0666)
+	if err != nil {
+		printErrorln("Error:", err)
+		return
+	}
+	defer file.Close()
+	if err := geoview.Convert(file, reader, reader.Size(), convertOpts); err != nil {
+		printErrorln("Error:", err)
+	}
+}
+
+// the database compiled from the source lists of -input, with all of its codes
+func buildList() (proto.Message, []string, error) {
+	var codes []string
+	switch global.Datatype {
+	case "geosite":
+		list, err := geosite.BuildGeoSite(global.Input)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, site := range list.Entry {
+			codes = append(codes, site.CountryCode)
+		}
+		return list, codes, nil
+	case "geoip":
+		list, err := geoip.BuildGeoIP(global.Input)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, entry := range list.Entry {
+			codes = append(codes, entry.CountryCode)
+		}
+		return list, codes, nil
+	}
+	return nil, nil, fmt.Errorf("build is not supported for %s", global.Datatype)
+}
+
+// merge the databases of -input into one, a code found in several inputs is
+// combined by the conflict policy
+func merge() {
+	switch global.Conflict {
+	case "union", "first-wins", "last-wins":
+	default:
+		printErrorln("Error: unknown conflict policy:", global.Conflict)
+		return
+	}
+	files, types, err := inputFiles()
+	if err != nil {
+		printErrorln("Error:", err)
+		return
+	}
+	want, err := plainCodes()
+	if err != nil {
+		printErrorln("Error:", err)
+		return
+	}
+
+	var (
+		list  proto.Message
+		codes []string
+	)
+	switch global.Datatype {
+	case "geosite":
+		var entries [][]*geosite.GeoSite
+		for i, file := range files {
+			sites, err := readGeoSiteList(file, types[i], want)
+			if err != nil {
+				printErrorln("Error:", file+":", err)
+				return
+			}
+			entries = append(entries, sites.Entry)
+		}
+		entries = resolveConflicts(entries, (*geosite.GeoSite).GetCountryCode)
+		var lists []*geosite.GeoSiteList
+		for _, sites := range entries {
+			lists = append(lists, &geosite.GeoSiteList{Entry: sites})
+		}
+		merged := geosite.MergeGeoSite(lists...)
+		for _, site := range merged.Entry {
+			codes = append(codes, site.CountryCode)
+		}
+		list = merged
+	case "geoip":
+		var entries [][]*geoip.GeoIP
+		for i, file := range files {
+			ips, err := readGeoIPList(file, types[i], want)
+			if err != nil {
+				printErrorln("Error:", file+":", err)
+				return
+			}
+			entries = append(entries, ips.Entry)
+		}
+		entries = resolveConflicts(entries, (*geoip.GeoIP).GetCountryCode)
+		var lists []*geoip.GeoIPList
+		for _, ips := range entries {
+			lists = append(lists, &geoip.GeoIPList{Entry: ips})
+		}
+		merged, err := geoip.MergeGeoIP(lists...)
+		if err != nil {
+			printErrorln("Error:", err)
+			return
+		}
+		geoip.FilterIPType(merged, ipType())
+		for _, entry := range merged.Entry {
+			codes = append(codes, entry.CountryCode)
+		}
+		list = merged
+	default:
+		printErrorln("Error: merge is not supported for", global.Datatype)
+		return
+	}
+
+	if err := checkCodes(want, codes); err != nil {
+		printErrorln("Error:", err)
+		return
+	}
+	outputDatabase(list, codes)
+}
+
+// codes of -list, which can't hold set operators as the codes are read from several inputs
+func plainCodes() ([]string, error) {
+	expr, err := codeset.Parse(global.Want)
+	if err != nil {
+		return nil, err
+	}
+	if !expr.Plain() {
+		return nil, fmt.Errorf("set operators are not supported by %s", global.Action)
+	}
+	return expr.Codes(), nil
+}
+
+// in strict mode, each wanted code must be found in one of the inputs
+func checkCodes(want []string, codes []string) error {
+	if !strict {
+		return nil
+	}
+	found := make(map[string]bool)
+	for _, code := range codes {
+		found[strings.ToUpper(code)] = true
+	}
+	for _, v := range want {
+		if code, _ := geosite.ParseCode(v); !found[code] {
+			return fmt.Errorf("%s doesn't exist", code)
+		}
+	}
+	return nil
+}
+
+// drop the entries of the codes taken by another input under the conflict policy,
+// entries are grouped by input in the order of -input
+func resolveConflicts[T any](entries [][]T, codeOf func(T) string) [][]T {
+	owner := make(map[string]int)
+	for i, list := range entries {
+		for _, entry := range list {
+			code := strings.ToUpper(codeOf(entry))
+			switch global.Conflict {
+			case "first-wins":
+				if _, ok := owner[code]; !ok {
+					owner[code] = i
+				}
+			case "last-wins":
+				owner[code] = i
+			}
+		}
+	}
+	for i := range entries {
+		entries[i] = common.Filter(entries[i], func(entry T) bool {
+			index, ok := owner[strings.ToUpper(codeOf(entry))]
+			return !ok || index == i
+		})
+	}
+	return entries
+}
+
+// all or the wanted codes of a geosite database, or the domains of a rule-set
+// named after the file
+func readGeoSiteList(file string, datatype string, want []string) (*geosite.GeoSiteList, error) {
+	switch datatype {
+	case "geosite":
+		handler := geosite.NewGeositeHandler(file, false, global.Lowmem)
+		if len(want) == 0 {
+			codes, err := handler.Codes()
+			if err != nil {
+				return nil, err
+			}
+			want = codes
+		}
+		wantMap := make(map[string][]string)
+		for _, v := range want {
+			code, attrs := geosite.ParseCode(v)
+			wantMap[code] = attrs
+		}
+		return handler.ToGeosite(wantMap)
+	case "ruleset":
+		reader := &ruleset.RuleSetIn{
+			URI: file,
+			Want: map[string]bool{
+				ruleset.CodeDomain:        true,
+				ruleset.CodeDomainSuffix:  true,
+				ruleset.CodeDomainKeyword: true,
+				ruleset.CodeDomainRegex:   true,
+			},
+		}
+		list, err := reader.ToGeosite()
+		if err != nil {
+			return nil, err
+		}
+		list.Entry = common.Filter(list.Entry, func(site *geosite.GeoSite) bool {
+			return wanted(want, site.CountryCode)
+		})
+		return list, nil
+	}
+	return nil, fmt.Errorf("%s can't be merged into geosite", datatype)
+}
+
+// all or the wanted codes of a geoip database, or the ip-cidr of a rule-set
+// named after the file
+func readGeoIPList(file string, datatype string, want []string) (*geoip.GeoIPList, error) {
+	switch datatype {
+	case "geoip":
+		data := &geoip.GeoIPDatIn{
+			URI:    file,
+			Want:   make(map[string]bool),
+			Lowmem: global.Lowmem,
+		}
+		if len(want) == 0 {
+			codes, err := data.Codes()
+			if err != nil {
+				return nil, err
+			}
+			want = codes
+		}
+		for _, code := range want {
+			data.Want[strings.ToUpper(code)] = true
+		}
+		return data.ToGeoIP()
+	case "ruleset":
+		reader := &ruleset.RuleSetIn{
+			URI:  file,
+			Want: map[string]bool{ruleset.CodeIPCIDR: true},
+		}
+		// ip versions are filtered after merging, the same as other inputs
+		list, err := reader.ToGeoIP(geoip.IPv4 | geoip.IPv6)
+		if err != nil {
+			return nil, err
+		}
+		list.Entry = common.Filter(list.Entry, func(entry *geoip.GeoIP) bool {
+			return wanted(want, entry.CountryCode)
+		})
+		return list, nil
+	}
+	return nil, fmt.Errorf("%s can't be merged into geoip", datatype)
+}
+
+// report whether the code is in the wanted list, everything is wanted by an empty list
+func wanted(want []string, code string) bool {
+	if len(want) == 0 {
+		return true
+	}
+	for _, v := range want {
+		if strings.EqualFold(v, code) {
+			return true
+		}
+	}
+	return false
+}
+
+// changes of a code between two databases
+type codeDiff struct {
+	Code    string   `json:"code"`
+	Status  string   `json:"status"` // added | removed | changed
+	Added   []string `json:"added,omitempty"`
+	Removed []string `json:"removed,omitempty"`
+}
+
+// compare two databases, the first -input is the old one. changes are printed as
+// text, or json with -format json
+func diff() {
+	files, types, err := inputFiles()
+	if err != nil {
+		printErrorln("Error:", err)
+		return
+	}
+	if len(files) != 2 {
+		printErrorln("Error: diff compares exactly two databases, the old one and the new one")
+		return
+	}
+	want, err := plainCodes()
+	if err != nil {
+		printErrorln("Error:", err)
+		return
+	}
+
+	var (
+		changes []codeDiff
+		codes   []string
+	)
+	switch global.Datatype {
+	case "geosite":
+		var sites [2]map[string]*geosite.GeoSite
+		for i, file := range files {
+			list, err := readGeoSiteList(file, types[i], want)
+			if err != nil {
+				printErrorln("Error:", file+":", err)
+				return
+			}
+			sites[i] = make(map[string]*geosite.GeoSite)
+			for _, site := range list.Entry {
+				sites[i][strings.ToUpper(site.CountryCode)] = site
+			}
+		}
+		codes = diffCodes(sites[0], sites[1])
+		for _, code := range codes {
+			added, removed := geosite.DiffGeoSite(sites[0][code], sites[1][code])
+			changes = appendCodeDiff(changes, code, sites[0][code] != nil, sites[1][code] != nil, added, removed)
+		}
+	case "geoip":
+		var ips [2]map[string]*geoip.GeoIP
+		for i, file := range files {
+			list, err := readGeoIPList(file, types[i], want)
+			if err != nil {
+				printErrorln("Error:", file+":", err)
+				return
+			}
+			ips[i] = make(map[string]*geoip.GeoIP)
+			for _, entry := range list.Entry {
+				ips[i][strings.ToUpper(entry.CountryCode)] = entry
+			}
+		}
+		codes = diffCodes(ips[0], ips[1])
+		for _, code := range codes {
+			added, removed, err := geoip.DiffGeoIP(ips[0][code], ips[1][code])
+			if err != nil {
+				printErrorln("Error:", code+":", err)
+				return
+			}
+			changes = appendCodeDiff(changes, code, ips[0][code] != nil, ips[1][code] != nil, prefixStrings(added), prefixStrings(removed))
+		}
+	default:
+		printErrorln("Error: diff is not supported for", global.Datatype)
+		return
+	}
+	if err := checkCodes(want, codes); err != nil {
+		printErrorln("Error:", err)
+		return
+	}
+
+	if global.Format == "json" {
+		if changes == nil {
+			changes = []codeDiff{}
+		}
+		b, _ := json.Marshal(changes)
+		outputLines([]string{string(b)})
+		return
+	}
+	var lines []string
+	count := make(map[string]int)
+	for _, change := range changes {
+		count[change.Status]++
+		switch change.Status {
+		case "added":
+			lines = append(lines, "+ "+change.Code)
+		case "removed":
+			lines = append(lines, "- "+change.Code)
+		default:
+			lines = append(lines, "~ "+change.Code)
+		}
+		for _, v := range change.Added {
+			lines = append(lines, "    + "+v)
+		}
+		for _, v := range change.Removed {
+			lines = append(lines, "    - "+v)
+		}
+	}
+	lines = append(lines, fmt.Sprintf("%d codes added, %d removed, %d changed", count["added"], count["removed"], count["changed"]))
+	outputLines(lines)
+}
+
+// the sorted codes of both databases
+func diffCodes[T any](before, after map[string]T) []string {
+	var codes []string
+	for code := range before {
+		codes = append(codes, code)
+	}
+	for code := range after {
+		if _, ok := before[code]; !ok {
+			codes = append(codes, code)
+		}
+	}
+	sort.Strings(codes)
+	return codes
+}
+
+// append the changes of the code unless it's unchanged
+func appendCodeDiff(changes []codeDiff, code string, inOld bool, inNew bool, added []string, removed []string) []codeDiff {
+	status := "changed"
+	switch {
+	case !inOld:
+		status = "added"
+	case !inNew:
+		status = "removed"
+	case len(added) == 0 && len(removed) == 0:
+		return changes
+	}
+	return append(changes, codeDiff{
+		Code:    code,
+		Status:  status,
+		Added:   added,
+		Removed: removed,
+	})
+}
+
+func prefixStrings(prefixes []netip.Prefix) []string {
+	list := make([]string, 0, len(prefixes))
+	for _, prefix := range prefixes {
+		list = append(list, prefix.String())
+	}
+	return list
+}
+
+// -input can be given more than once
+type inputList []string
+
+func (l *inputList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *inputList) Set(value string) error {
+	*l = append(*l, value)
+	global.Inputs = *l
+	global.Input = global.Inputs[0]
+	return nil
+}
+
 // list all stored codes in the database
 func listCodes() {
 	switch global.Datatype {
 	case "geoip":
+		// load as sing-box or maxmind db
+		if db, err := geoip.LoadMMDB(global.Input); err == nil {
+			defer db.Close()
+			codes, err := db.Codes()
+			if err != nil {
+				printErrorln("Error:", err)
+				return
+			}
+			fmt.Println("Available codes:")
+			for _, code := range codes {
+				fmt.Println(code)
+			}
+			return
+		}
+		// load as v2ray db
 		file, err := os.Open(global.Input)
 		if err != nil {
 			printErrorln("Can't open input file")
@@ -132,21 +686,30 @@ func listCodes() {
 			fmt.Println(string(code))
 		}
 		return
+
+	case "ruleset":
+		data := &ruleset.RuleSetIn{
+			URI: global.Input,
+		}
+		codes, err := data.Codes()
+		if err != nil {
+			printErrorln("Error:", err)
+			return
+		}
+		fmt.Println("Available codes:")
+		for _, code := range codes {
+			fmt.Println(code)
+		}
 	}
 }
 
 func extract() {
 	switch global.Datatype {
 	case "geoip":
-		list := strings.Split(global.Want, ",")
-		wantMap := make(map[string]bool)
-		for _, v := range list {
-			wantMap[strings.ToUpper(strings.TrimSpace(v))] = true
-		}
-		data := &geoip.GeoIPDatIn{
-			URI:       global.Input,
-			Want:      wantMap,
-			MustExist: strict,
+		data, err := newGeoIPData()
+		if err != nil {
+			printErrorln("Error:", err)
+			return
 		}
 		var tp geoip.IPType = 0
 		if global.Ipv4 {
@@ -156,6 +719,9 @@ func extract() {
 			tp |= geoip.IPv6
 		}
 		ret, err := data.Extract(tp)
+		if err == nil && global.IPFormat != "cidr" {
+			ret, err = ipFormat(ret)
+		}
 		if err == nil {
 			if global.Output != "" { // output to file
 				err = outputToFile(global.Output, ret, global.Appendfile)
@@ -173,13 +739,11 @@ func extract() {
 		return
 
 	case "geosite":
-		list := strings.Split(global.Want, ",")
-		wantMap := make(map[string][]string)
-		for _, v := range list {
-			parts := strings.Split(strings.ToLower(v), "@") // attributes are lowercased
-			wantMap[strings.ToUpper(parts[0])] = parts[1:]
+		gsreader, wantMap, err := newGeositeHandler()
+		if err != nil {
+			printErrorln("Error:", err)
+			return
 		}
-		gsreader := geosite.NewGeositeHandler(global.Input, strict, global.Lowmem)
 		ret, err := gsreader.Extract(wantMap, global.Regex)
 		if err == nil {
 			if global.Output != "" { // output to file
@@ -195,21 +759,38 @@ func extract() {
 		} else {
 			printErrorln("Error:", err)
 		}
+
+	case "ruleset":
+		data := &ruleset.RuleSetIn{
+			URI:       global.Input,
+			Want:      rulesetWantMap(),
+			MustExist: strict,
+		}
+		ret, err := data.Extract(ipType())
+		if err == nil {
+			if global.Output != "" { // output to file
+				err = outputToFile(global.Output, ret, global.Appendfile)
+				if err != nil {
+					printErrorln("Error:", err)
+				}
+				return
+			}
+			for _, v := range ret {
+				fmt.Println(v)
+			}
+		} else {
+			printErrorln("Error:", err)
+		}
 	}
 }
 
 func convert() {
 	switch global.Datatype {
 	case "geoip":
-		list := strings.Split(global.Want, ",")
-		wantMap := make(map[string]bool)
-		for _, v := range list {
-			wantMap[strings.ToUpper(strings.TrimSpace(v))] = true
-		}
-		data := &geoip.GeoIPDatIn{
-			URI:       global.Input,
-			Want:      wantMap,
-			MustExist: strict,
+		data, err := newGeoIPData()
+		if err != nil {
+			printErrorln("Error:", err)
+			return
 		}
 		var tp geoip.IPType = 0
 		if global.Ipv4 {
@@ -247,16 +828,6 @@ func convert() {
 				printErrorln("Error: Output file for geoip conversion is required")
 				return
 			}
-			list := strings.Split(global.Want, ",")
-			wantMap := make(map[string]bool)
-			for _, v := range list {
-				wantMap[strings.ToUpper(strings.TrimSpace(v))] = true
-			}
-			data := &geoip.GeoIPDatIn{
-				URI:       global.Input,
-				Want:      wantMap,
-				MustExist: strict,
-			}
 			ret, err := data.ToGeoIP()
 			if err == nil {
 				protoBytes, err := proto.Marshal(ret)
@@ -269,32 +840,64 @@ func convert() {
 			} else {
 				printErrorln("Error:", err)
 			}
-		case "qx":
-			fallthrough
-		case "quantumultx":
-			ret, err := data.ToQuantumultX(tp)
+		case "mmdb":
+			if global.Output == "" {
+				printErrorln("Error: Output file for mmdb conversion is required")
+				return
+			}
+			ret, err := data.ToGeoIP()
 			if err == nil {
-				if global.Output != "" {
-					outputToFile(global.Output, ret, global.Appendfile)
-				} else {
-					for _, v := range ret {
-						fmt.Println(v)
-					}
+				err = outputMMDBToFile(global.Output, ret)
+			}
+			if err != nil {
+				printErrorln("Error:", err)
+			}
+		case "qx", "quantumultx", "surge", "loon", "shadowrocket":
+			template, err := ruleTemplate()
+			if err == nil {
+				var ret []string
+				ret, err = data.Extract(tp)
+				if err == nil {
+					outputLines(template.FromCIDR(ret))
 				}
+			}
+			if err != nil {
+				printErrorln("Error:", err)
+			}
+		case "clash":
+			fallthrough
+		case "clash-text":
+			ret, err := data.Extract(tp)
+			if err == nil {
+				ret, err = geoip.CIDRToClashRule(ret, clashBehavior())
+			}
+			if err == nil {
+				outputClash(ret)
 			} else {
 				printErrorln("Error:", err)
 			}
+		case "mrs":
+			if global.Output == "" {
+				printErrorln("Error: Output file for mrs conversion is required")
+				return
+			}
+			ret, err := data.ToRuleSet(tp)
+			if err == nil {
+				err = outputMrsToFile(global.Output, ret)
+			}
+			if err != nil {
+				printErrorln("Error:", err)
+			}
 		default:
 			printErrorln("Error: converting from", global.Datatype, "to", global.Format, "is not supported")
 		}
 		return
 
 	case "geosite":
-		list := strings.Split(global.Want, ",")
-		wantMap := make(map[string][]string)
-		for _, v := range list {
-			parts := strings.Split(strings.ToLower(v), "@") // attributes are lowercased
-			wantMap[strings.ToUpper(parts[0])] = parts[1:]
+		gsreader, wantMap, err := newGeositeHandler()
+		if err != nil {
+			printErrorln("Error:", err)
+			return
 		}
 		// convert to the target format according to the format arg
 		switch global.Format {
@@ -303,7 +906,6 @@ func convert() {
 		case "srs":
 			fallthrough
 		case "ruleset": //ruleset binary
-			gsreader := geosite.NewGeositeHandler(global.Input, strict, global.Lowmem)
 			ret, err := gsreader.ToRuleSet(wantMap, global.Regex)
 			if err == nil {
 				if global.Output != "" { // output to file
@@ -326,7 +928,6 @@ func convert() {
 				printErrorln("Error: Output file for geosite conversion is required")
 				return
 			}
-			gsreader := geosite.NewGeositeHandler(global.Input, strict, global.Lowmem)
 			ret, err := gsreader.ToGeosite(wantMap)
 			if err == nil {
 				protoBytes, err := proto.Marshal(ret)
@@ -339,22 +940,171 @@ func convert() {
 			} else {
 				printErrorln("Error:", err)
 			}
-		case "qx":
+		case "singsite":
+			if global.Output == "" {
+				printErrorln("Error: Output file for sing-box geosite conversion is required")
+				return
+			}
+			ret, err := gsreader.ToGeosite(wantMap)
+			if err == nil {
+				err = outputSingSiteToFile(global.Output, ret)
+			}
+			if err != nil {
+				printErrorln("Error:", err)
+			}
+		case "qx", "quantumultx", "surge", "loon", "shadowrocket":
+			template, err := ruleTemplate()
+			if err == nil {
+				var items []geosite.Item
+				items, err = gsreader.ExtractItems(wantMap, false)
+				if err == nil {
+					outputLines(template.FromItems(items))
+				}
+			}
+			if err != nil {
+				printErrorln("Error:", err)
+			}
+		case "clash":
+			fallthrough
+		case "clash-text":
+			items, err := gsreader.ExtractItems(wantMap, global.Regex)
+			if err == nil {
+				var ret []string
+				ret, err = geosite.ItemToClashRule(items, clashBehavior())
+				if err == nil {
+					outputClash(ret)
+				}
+			}
+			if err != nil {
+				printErrorln("Error:", err)
+			}
+		case "mrs":
+			if global.Output == "" {
+				printErrorln("Error: Output file for mrs conversion is required")
+				return
+			}
+			ret, err := gsreader.ToRuleSet(wantMap, false)
+			if err == nil {
+				err = outputMrsToFile(global.Output, ret)
+			}
+			if err != nil {
+				printErrorln("Error:", err)
+			}
+		default:
+			printErrorln("Error: converting from", global.Datatype, "to", global.Format, "is not supported")
+		}
+
+	case "ruleset":
+		data := &ruleset.RuleSetIn{
+			URI:       global.Input,
+			Want:      rulesetWantMap(),
+			MustExist: strict,
+		}
+		// convert to the target format according to the format arg
+		switch global.Format {
+		case "json": // ruleset json
+			fallthrough
+		case "srs":
 			fallthrough
-		case "quantumultx":
-			gsreader := geosite.NewGeositeHandler(global.Input, strict, global.Lowmem)
-			ret, err := gsreader.ToQuantumultX(wantMap)
+		case "ruleset": //ruleset binary
+			ret, err := data.ToRuleSet(ipType())
 			if err == nil {
-				if global.Output != "" {
-					outputToFile(global.Output, ret, global.Appendfile)
-				} else {
-					for _, v := range ret {
-						fmt.Println(v)
+				if global.Output != "" { // output to file
+					err = outputRulesetToFile(global.Output, ret, global.Format)
+					if err != nil {
+						printErrorln("Error:", err)
 					}
+					return
+				}
+				// output json to stdout
+				stdjson := json.NewEncoder(os.Stdout)
+				if err = stdjson.Encode(*ret); err != nil {
+					printErrorln("Error:", err, ret)
+				}
+			} else {
+				printErrorln("Error:", err)
+			}
+		case "geosite":
+			if global.Output == "" {
+				printErrorln("Error: Output file for geosite conversion is required")
+				return
+			}
+			ret, err := data.ToGeosite()
+			if err == nil {
+				err = outputProtoToFile(global.Output, ret)
+			}
+			if err != nil {
+				printErrorln("Error:", err)
+			}
+		case "singsite":
+			if global.Output == "" {
+				printErrorln("Error: Output file for sing-box geosite conversion is required")
+				return
+			}
+			ret, err := data.ToGeosite()
+			if err == nil {
+				err = outputSingSiteToFile(global.Output, ret)
+			}
+			if err != nil {
+				printErrorln("Error:", err)
+			}
+		case "geoip":
+			if global.Output == "" {
+				printErrorln("Error: Output file for geoip conversion is required")
+				return
+			}
+			ret, err := data.ToGeoIP(ipType())
+			if err == nil {
+				err = outputProtoToFile(global.Output, ret)
+			}
+			if err != nil {
+				printErrorln("Error:", err)
+			}
+		case "mmdb":
+			if global.Output == "" {
+				printErrorln("Error: Output file for mmdb conversion is required")
+				return
+			}
+			ret, err := data.ToGeoIP(ipType())
+			if err == nil {
+				err = outputMMDBToFile(global.Output, ret)
+			}
+			if err != nil {
+				printErrorln("Error:", err)
+			}
+		case "qx", "quantumultx", "surge", "loon", "shadowrocket":
+			template, err := ruleTemplate()
+			if err == nil {
+				var ret []string
+				ret, err = data.ToRuleList(ipType(), template)
+				if err == nil {
+					outputLines(ret)
 				}
+			}
+			if err != nil {
+				printErrorln("Error:", err)
+			}
+		case "clash":
+			fallthrough
+		case "clash-text":
+			ret, err := data.ToClash(ipType(), clashBehavior())
+			if err == nil {
+				outputClash(ret)
 			} else {
 				printErrorln("Error:", err)
 			}
+		case "mrs":
+			if global.Output == "" {
+				printErrorln("Error: Output file for mrs conversion is required")
+				return
+			}
+			ret, err := data.ToRuleSet(ipType())
+			if err == nil {
+				err = outputMrsToFile(global.Output, ret)
+			}
+			if err != nil {
+				printErrorln("Error:", err)
+			}
 		default:
 			printErrorln("Error: converting from", global.Datatype, "to", global.Format, "is not supported")
 		}
@@ -362,6 +1112,19 @@ func convert() {
 }
 
 func lookup() {
+	if global.Target == "-" || global.Values != "" {
+		batchLookup()
+		return
+	}
+	if r, ok := geoip.ParseIPRange(global.Target); ok {
+		rangeLookup(r)
+		return
+	}
+	// a single geoip or geosite is looked up without loading all codes
+	if global.Explain || len(global.Inputs) > 1 || global.Datatype == "ruleset" || isDir(global.Input) {
+		matcherLookup()
+		return
+	}
 	switch global.Datatype {
 	case "geoip":
 		data := &geoip.GeoIPDatIn{
@@ -385,6 +1148,494 @@ func lookup() {
 	}
 }
 
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+// render the cidr list in the format of -ipformat
+func ipFormat(list []string) ([]string, error) {
+	switch global.IPFormat {
+	case "cidr":
+		return list, nil
+	case "range":
+		return geoip.CIDRToRange(list, cidr.OutputTypeRange)
+	case "both":
+		return geoip.CIDRToRange(list, cidr.OutputTypeSum)
+	}
+	return nil, fmt.Errorf("unknown ip format: %s", global.IPFormat)
+}
+
+// geoip reader of the codes in -list, which may use set operators
+func newGeoIPData() (*geoip.GeoIPDatIn, error) {
+	expr, err := codeset.Parse(global.Want)
+	if err != nil {
+		return nil, err
+	}
+	wantMap := make(map[string]bool)
+	for _, code := range expr.Codes() {
+		wantMap[strings.ToUpper(code)] = true
+	}
+	return &geoip.GeoIPDatIn{
+		URI:        global.Input,
+		Want:       wantMap,
+		MustExist:  strict,
+		Expression: expr,
+		Merge:      global.Merge,
+		Invert:     global.Invert,
+		Lowmem:     global.Lowmem,
+	}, nil
+}
+
+// geosite handler and the want list of -list, the expression is evaluated by
+// the handler if set operators are used
+func newGeositeHandler() (geosite.GSHandler, map[string][]string, error) {
+	expr, err := codeset.Parse(global.Want)
+	if err != nil {
+		return nil, nil, err
+	}
+	wantMap := make(map[string][]string)
+	for _, v := range expr.Codes() {
+		code, attrs := geosite.ParseCode(v)
+		wantMap[code] = attrs
+	}
+	gsreader := geosite.NewGeositeHandler(global.Input, strict, global.Lowmem)
+	if !expr.Plain() {
+		gsreader = geosite.NewExprHandler(gsreader, expr)
+	}
+	return gsreader, wantMap, nil
+}
+
+// a rule which matched the lookup target
+type lookupMatch struct {
+	Code string `json:"code"`
+	Rule string `json:"rule"`
+}
+
+// lookup matchers built once for many targets, overlaps is nil for databases
+// without ip
+type lookupMatcher struct {
+	match    func(target string) []string
+	explain  func(target string) []lookupMatch
+	overlaps func(r netipx.IPRange) ([]geoip.Overlap, error)
+	close    func() error
+}
+
+// files of -input to look up in or to merge, directories are expanded into the
+// files they contain. the type of each file is detected if there are more than one file
+func inputFiles() (files []string, types []string, err error) {
+	detect := len(global.Inputs) > 1
+	for _, input := range global.Inputs {
+		info, err := os.Stat(input)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, input)
+			continue
+		}
+		detect = true
+		entries, err := os.ReadDir(input)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, entry := range entries {
+			path := filepath.Join(input, entry.Name())
+			// files of unknown types in a directory are skipped
+			if entry.Type().IsRegular() && detectType(path) != "" {
+				files = append(files, path)
+			}
+		}
+	}
+	if len(files) == 0 {
+		return nil, nil, fmt.Errorf("no database found in %s", strings.Join(global.Inputs, ", "))
+	}
+	for _, file := range files {
+		datatype := global.Datatype
+		if detect {
+			if datatype = detectType(file); datatype == "" {
+				return nil, nil, fmt.Errorf("%s: unknown database type", file)
+			}
+		}
+		types = append(types, datatype)
+	}
+	return files, types, nil
+}
+
+// detect the type of a database by its content
+func detectType(path string) string {
+	switch {
+	case ruleset.IsRuleSet(path):
+		return "ruleset"
+	case geoip.IsGeoIP(path):
+		return "geoip"
+	case geosite.IsGeosite(path):
+		return "geosite"
+	}
+	return ""
+}
+
+// matchers of all files of -input, codes are labelled by the file name if
+// there are more than one file
+func newLookupMatcher() (*lookupMatcher, error) {
+	files, types, err := inputFiles()
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 1 {
+		return newFileMatcher(files[0], types[0])
+	}
+	var matchers []*lookupMatcher
+	closeAll := func() error {
+		for _, matcher := range matchers {
+			matcher.close()
+		}
+		return nil
+	}
+	for i, file := range files {
+		matcher, err := newFileMatcher(file, types[i])
+		if err != nil {
+			closeAll()
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		matchers = append(matchers, matcher)
+	}
+	return &lookupMatcher{
+		match: func(target string) []string {
+			list := []string{}
+			for i, matcher := range matchers {
+				for _, code := range matcher.match(target) {
+					list = append(list, filepath.Base(files[i])+":"+code)
+				}
+			}
+			return list
+		},
+		explain: func(target string) []lookupMatch {
+			var list []lookupMatch
+			for i, matcher := range matchers {
+				for _, m := range matcher.explain(target) {
+					list = append(list, lookupMatch{filepath.Base(files[i]) + ":" + m.Code, m.Rule})
+				}
+			}
+			return list
+		},
+		overlaps: func(r netipx.IPRange) ([]geoip.Overlap, error) {
+			list := []geoip.Overlap{}
+			for i, matcher := range matchers {
+				if matcher.overlaps == nil {
+					continue
+				}
+				overlaps, err := matcher.overlaps(r)
+				if err != nil {
+					return nil, fmt.Errorf("%s: %w", files[i], err)
+				}
+				for _, o := range overlaps {
+					o.Code = filepath.Base(files[i]) + ":" + o.Code
+					list = append(list, o)
+				}
+			}
+			return list, nil
+		},
+		close: closeAll,
+	}, nil
+}
+
+func newFileMatcher(file string, datatype string) (*lookupMatcher, error) {
+	switch datatype {
+	case "geoip":
+		data := &geoip.GeoIPDatIn{
+			URI:       file,
+			MustExist: strict,
+		}
+		finder, err := data.NewFinder()
+		if err != nil {
+			return nil, err
+		}
+		return &lookupMatcher{
+			match: finder.Find,
+			explain: func(target string) []lookupMatch {
+				var list []lookupMatch
+				for _, m := range finder.Explain(target) {
+					list = append(list, lookupMatch{m.Code, m.Rule})
+				}
+				return list
+			},
+			overlaps: finder.Overlaps,
+			close:    finder.Close,
+		}, nil
+	case "geosite":
+		matcher, err := geosite.NewGeositeHandler(file, strict, global.Lowmem).NewMatcher()
+		if err != nil {
+			return nil, err
+		}
+		return &lookupMatcher{
+			match: matcher.Match,
+			explain: func(target string) []lookupMatch {
+				var list []lookupMatch
+				for _, m := range matcher.Explain(target) {
+					list = append(list, lookupMatch{m.Code, m.Rule})
+				}
+				return list
+			},
+			close: func() error { return nil },
+		}, nil
+	case "ruleset":
+		data := &ruleset.RuleSetIn{
+			URI:       file,
+			MustExist: strict,
+		}
+		matcher, err := data.NewMatcher()
+		if err != nil {
+			return nil, err
+		}
+		return &lookupMatcher{
+			match: matcher.Match,
+			explain: func(target string) []lookupMatch {
+				var list []lookupMatch
+				for _, m := range matcher.Explain(target) {
+					list = append(list, lookupMatch{m.Path, m.Rule})
+				}
+				return list
+			},
+			close: func() error { return nil },
+		}, nil
+	}
+	return nil, fmt.Errorf("lookup is not supported for %s", datatype)
+}
+
+// look up the codes sharing ips with the cidr or range of -value
+func rangeLookup(r netipx.IPRange) {
+	matcher, err := newLookupMatcher()
+	if err != nil {
+		printErrorln("Error:", err)
+		return
+	}
+	defer matcher.close()
+	if matcher.overlaps == nil {
+		printErrorln("Error: cidr lookup is only supported for geoip")
+		return
+	}
+	list, err := matcher.overlaps(r)
+	if err != nil {
+		printErrorln("Error:", err)
+		return
+	}
+	for _, o := range list {
+		prefixes := make([]string, 0, len(o.Prefixes))
+		for _, prefix := range o.Prefixes {
+			prefixes = append(prefixes, prefix.String())
+		}
+		fmt.Println(o.Code + "\t" + o.Relation + "\t" + strings.Join(prefixes, ","))
+	}
+}
+
+// look up -value with matchers of all inputs, the matched rules are printed
+// with -explain
+func matcherLookup() {
+	matcher, err := newLookupMatcher()
+	if err != nil {
+		printErrorln("Error:", err)
+		return
+	}
+	defer matcher.close()
+	if !global.Explain {
+		for _, code := range matcher.match(global.Target) {
+			fmt.Println(code)
+		}
+		return
+	}
+	for _, m := range matcher.explain(global.Target) {
+		fmt.Println(m.Code + "\t" + m.Rule)
+	}
+}
+
+// look up every line of -values, or stdin if -value is "-". matchers are built
+// once, results are written as tab separated values, or json lines if -format
+// is json. other formats are ignored as lookup has no output format otherwise
+func batchLookup() {
+	matcher, err := newLookupMatcher()
+	if err != nil {
+		printErrorln("Error:", err)
+		return
+	}
+	defer matcher.close()
+
+	input := io.Reader(os.Stdin)
+	if global.Values != "" {
+		file, err := os.Open(global.Values)
+		if err != nil {
+			printErrorln("Error:", err)
+			return
+		}
+		defer file.Close()
+		input = file
+	}
+
+	var lines []string
+	stdout := bufio.NewWriter(os.Stdout)
+	defer stdout.Flush()
+	emit := func(line string) {
+		if global.Output != "" {
+			lines = append(lines, line)
+		} else {
+			fmt.Fprintln(stdout, line)
+		}
+	}
+	scanner := bufio.NewScanner(input)
+	for scanner.Scan() {
+		target := strings.TrimSpace(scanner.Text())
+		if target == "" || strings.HasPrefix(target, "#") {
+			continue
+		}
+		codes := matcher.match(target)
+		if codes == nil {
+			codes = []string{}
+		}
+		var matches []lookupMatch
+		if global.Explain {
+			matches = matcher.explain(target)
+		}
+		if global.Format == "json" {
+			b, _ := json.Marshal(struct {
+				Target  string        `json:"target"`
+				Codes   []string      `json:"codes"`
+				Matches []lookupMatch `json:"matches,omitempty"`
+			}{target, codes, matches})
+			emit(string(b))
+		} else if global.Explain {
+			// a line for each matched rule
+			if len(matches) == 0 {
+				emit(target + "\t\t")
+			}
+			for _, m := range matches {
+				emit(target + "\t" + m.Code + "\t" + m.Rule)
+			}
+		} else {
+			emit(target + "\t" + strings.Join(codes, ","))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		printErrorln("Error:", err)
+		return
+	}
+	if global.Output != "" {
+		if err := outputToFile(global.Output, lines, global.Appendfile); err != nil {
+			printErrorln("Error:", err)
+		}
+	}
+}
+
+// item types of a rule-set are used as its codes
+func rulesetWantMap() map[string]bool {
+	list := strings.Split(global.Want, ",")
+	wantMap := make(map[string]bool)
+	for _, v := range list {
+		wantMap[strings.ToLower(strings.TrimSpace(v))] = true
+	}
+	return wantMap
+}
+
+func ipType() geoip.IPType {
+	var tp geoip.IPType = 0
+	if global.Ipv4 {
+		tp |= geoip.IPv4
+	}
+	if global.Ipv6 {
+		tp |= geoip.IPv6
+	}
+	return tp
+}
+
+func outputProtoToFile(fileName string, m proto.Message) error {
+	protoBytes, err := proto.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(fileName, protoBytes, 0644)
+}
+
+func outputSingSiteToFile(fileName string, list *geosite.GeoSiteList) error {
+	file, err := os.OpenFile(fileName, os.O_WRONLY|os.O_TRUNC|os.O_CREATE, 0666)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return geosite.WriteSingSite(file, list)
+}
+
+func outputMMDBToFile(fileName string, list *geoip.GeoIPList) error {
+	file, err := os.OpenFile(fileName, os.O_WRONLY|os.O_TRUNC|os.O_CREATE, 0666)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return geoip.WriteMMDB(file, list)
+}
+
+// rule template of the line based format, customized by the policy and options flags
+func ruleTemplate() (*rulelist.Template, error) {
+	template, err := rulelist.Get(global.Format)
+	if err != nil {
+		return nil, err
+	}
+	if global.Policy != "" {
+		template.Policy = global.Policy
+	}
+	if global.Options != "" {
+		template.Options = append(template.Options, strings.Split(global.Options, ",")...)
+	}
+	return template, nil
+}
+
+// behavior of the clash rule-provider, defaults to the natural one of the datafile type
+func clashBehavior() string {
+	if global.Behavior != "" {
+		return global.Behavior
+	}
+	switch global.Datatype {
+	case "geoip":
+		return "ipcidr"
+	case "geosite":
+		return "domain"
+	}
+	return "classical"
+}
+
+// output clash rule-provider payload in yaml, or plain text for clash-text
+func outputClash(rules []string) {
+	lines := rules
+	if global.Format != "clash-text" {
+		lines = geoview.ClashPayload(rules)
+		// the payload key is already there when appending to an existing file
+		if fileInfo, err := os.Stat(global.Output); global.Output != "" && global.Appendfile && err == nil && fileInfo.Size() > 0 {
+			lines = lines[1:]
+		}
+	}
+	outputLines(lines)
+}
+
+// output lines to the output file, or stdout if no output file is given
+func outputLines(lines []string) {
+	if global.Output != "" {
+		if err := outputToFile(global.Output, lines, global.Appendfile); err != nil {
+			printErrorln("Error:", err)
+		}
+		return
+	}
+	for _, v := range lines {
+		fmt.Println(v)
+	}
+}
+
+func outputMrsToFile(fileName string, ruleset *srs.PlainRuleSetCompat) error {
+	// the file is left untouched if the rule-set can't be written as mrs
+	var buf bytes.Buffer
+	if err := geoview.WriteMrs(&buf, ruleset); err != nil {
+		return err
+	}
+	return os.WriteFile(fileName, buf.Bytes(), 0666)
+}
+
 func outputRulesetToFile(fileName string, ruleset *srs.PlainRuleSetCompat, format string) error {
 	if strings.EqualFold(format, "json") {
 		//output json
@@ -0,0 +1,73 @@
+// mihomo (clash.meta) binary rule-provider
+package mrs
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+var MagicBytes = [4]byte{'M', 'R', 'S', 1} // MRSv1
+
+type Behavior uint8
+
+const (
+	BehaviorDomain Behavior = iota
+	BehaviorIPCIDR
+)
+
+type binaryWriter interface {
+	WriteBin(w io.Writer) error
+}
+
+// write a domain behavior rule-provider, domains are matched as is while suffixes
+// follow the sing-box semantic: "example.com" matches itself and all subdomains,
+// ".example.com" matches subdomains only
+func WriteDomain(writer io.Writer, domain []string, domainSuffix []string) error {
+	set := NewDomainSet(domain, domainSuffix)
+	if set == nil {
+		return errors.New("empty domain set")
+	}
+	return write(writer, BehaviorDomain, len(domain)+len(domainSuffix), set)
+}
+
+// write an ipcidr behavior rule-provider
+func WriteIPCIDR(writer io.Writer, cidr []string) error {
+	set, err := NewIPCIDRSet(cidr)
+	if err != nil {
+		return err
+	}
+	if len(set.rr) == 0 {
+		return errors.New("empty ip set")
+	}
+	return write(writer, BehaviorIPCIDR, len(cidr), set)
+}
+
+func write(writer io.Writer, behavior Behavior, count int, set binaryWriter) error {
+	encoder, err := zstd.NewWriter(writer, zstd.WithEncoderLevel(zstd.SpeedBestCompression))
+	if err != nil {
+		return err
+	}
+	// header
+	if _, err = encoder.Write(MagicBytes[:]); err != nil {
+		return err
+	}
+	// behavior
+	if _, err = encoder.Write([]byte{byte(behavior)}); err != nil {
+		return err
+	}
+	// count
+	if err = binary.Write(encoder, binary.BigEndian, int64(count)); err != nil {
+		return err
+	}
+	// extra, reserved by mihomo and always empty
+	if err = binary.Write(encoder, binary.BigEndian, int64(0)); err != nil {
+		return err
+	}
+	if err = set.WriteBin(encoder); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
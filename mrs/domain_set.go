@@ -0,0 +1,130 @@
+// source: component/trie/domain_set.go of mihomo
+package mrs
+
+import (
+	"encoding/binary"
+	"io"
+	"sort"
+	"strings"
+)
+
+const (
+	complexWildcard = "+"
+	domainStep      = "."
+)
+
+// DomainSet is the succinct trie mihomo uses to store domain rules,
+// keys are reversed domains so domains sharing a suffix share a prefix
+type DomainSet struct {
+	leaves, labelBitmap []uint64
+	labels              []byte
+}
+
+type qElt struct{ s, e, col int }
+
+// build the set in the same way as mihomo: "+.example.com" keys match subdomains
+// of example.com, and plain keys match the domain itself
+func NewDomainSet(domain []string, domainSuffix []string) *DomainSet {
+	keyMap := make(map[string]struct{})
+	for _, d := range domain {
+		if d = normalizeDomain(d); d != "" {
+			keyMap[d] = struct{}{}
+		}
+	}
+	for _, d := range domainSuffix {
+		subOnly := strings.HasPrefix(d, domainStep)
+		if d = normalizeDomain(d); d == "" {
+			continue
+		}
+		if !subOnly {
+			keyMap[d] = struct{}{}
+		}
+		keyMap[complexWildcard+domainStep+d] = struct{}{}
+	}
+	if len(keyMap) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(keyMap))
+	for key := range keyMap {
+		keys = append(keys, reverse(key))
+	}
+	// ensure that the same prefix is continuous
+	// and according to the ascending sequence of length
+	sort.Strings(keys)
+
+	ss := &DomainSet{}
+	lIdx := 0
+	queue := []qElt{{0, len(keys), 0}}
+	for i := 0; i < len(queue); i++ {
+		elt := queue[i]
+		if elt.col == len(keys[elt.s]) {
+			elt.s++
+			// a leaf node
+			setBit(&ss.leaves, i, 1)
+		}
+
+		for j := elt.s; j < elt.e; {
+			frm := j
+			for ; j < elt.e && keys[j][elt.col] == keys[frm][elt.col]; j++ {
+			}
+			queue = append(queue, qElt{frm, j, elt.col + 1})
+			ss.labels = append(ss.labels, keys[frm][elt.col])
+			setBit(&ss.labelBitmap, lIdx, 0)
+			lIdx++
+		}
+		setBit(&ss.labelBitmap, lIdx, 1)
+		lIdx++
+	}
+	return ss
+}
+
+func (ss *DomainSet) WriteBin(w io.Writer) error {
+	// version
+	if _, err := w.Write([]byte{1}); err != nil {
+		return err
+	}
+	// leaves
+	if err := binary.Write(w, binary.BigEndian, int64(len(ss.leaves))); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.BigEndian, ss.leaves); err != nil {
+		return err
+	}
+	// labelBitmap
+	if err := binary.Write(w, binary.BigEndian, int64(len(ss.labelBitmap))); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.BigEndian, ss.labelBitmap); err != nil {
+		return err
+	}
+	// labels
+	if err := binary.Write(w, binary.BigEndian, int64(len(ss.labels))); err != nil {
+		return err
+	}
+	_, err := w.Write(ss.labels)
+	return err
+}
+
+// lowercase and strip the leading and trailing dots, invalid domains become empty
+func normalizeDomain(domain string) string {
+	domain = strings.Trim(strings.ToLower(strings.TrimSpace(domain)), domainStep)
+	if domain == "" || strings.Contains(domain, "..") || strings.ContainsAny(domain, " /"+complexWildcard) {
+		return ""
+	}
+	return domain
+}
+
+func reverse(s string) string {
+	b := []byte(s)
+	for i, j := 0, len(b)-1; i < j; i, j = i+1, j-1 {
+		b[i], b[j] = b[j], b[i]
+	}
+	return string(b)
+}
+
+func setBit(bm *[]uint64, i int, v int) {
+	for i>>6 >= len(*bm) {
+		*bm = append(*bm, 0)
+	}
+	(*bm)[i>>6] |= uint64(v) << uint(i&63)
+}
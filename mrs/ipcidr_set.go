@@ -0,0 +1,55 @@
+// source: component/cidr/ipcidr_set.go of mihomo
+package mrs
+
+import (
+	"encoding/binary"
+	"io"
+	"net/netip"
+
+	"go4.org/netipx"
+)
+
+// IPCIDRSet stores merged ip ranges, ipv4 addresses are written as ipv4-mapped ipv6
+type IPCIDRSet struct {
+	rr []netipx.IPRange
+}
+
+func NewIPCIDRSet(cidr []string) (*IPCIDRSet, error) {
+	var builder netipx.IPSetBuilder
+	for _, v := range cidr {
+		prefix, err := netip.ParsePrefix(v)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(v)
+			if addrErr != nil {
+				return nil, err
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		builder.AddPrefix(prefix)
+	}
+	set, err := builder.IPSet()
+	if err != nil {
+		return nil, err
+	}
+	return &IPCIDRSet{rr: set.Ranges()}, nil
+}
+
+func (ss *IPCIDRSet) WriteBin(w io.Writer) error {
+	// version
+	if _, err := w.Write([]byte{1}); err != nil {
+		return err
+	}
+	// rr
+	if err := binary.Write(w, binary.BigEndian, int64(len(ss.rr))); err != nil {
+		return err
+	}
+	for _, r := range ss.rr {
+		if err := binary.Write(w, binary.BigEndian, r.From().As16()); err != nil {
+			return err
+		}
+		if err := binary.Write(w, binary.BigEndian, r.To().As16()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+package mrs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net/netip"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"go4.org/netipx"
+)
+
+// read the header of a rule-provider and return the decompressed set that follows
+func readHeader(t *testing.T, data []byte, behavior Behavior, count int) io.Reader {
+	decoder, err := zstd.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(decoder.Close)
+	var header struct {
+		Magic    [4]byte
+		Behavior Behavior
+		Count    int64
+		Extra    int64
+	}
+	if err := binary.Read(decoder, binary.BigEndian, &header); err != nil {
+		t.Fatal(err)
+	}
+	if header.Magic != MagicBytes || header.Behavior != behavior || header.Count != int64(count) || header.Extra != 0 {
+		t.Fatalf("unexpected header %+v", header)
+	}
+	return decoder
+}
+
+func readSlice[T uint64 | byte](t *testing.T, r io.Reader) []T {
+	var length int64
+	if err := binary.Read(r, binary.BigEndian, &length); err != nil {
+		t.Fatal(err)
+	}
+	list := make([]T, length)
+	if err := binary.Read(r, binary.BigEndian, list); err != nil {
+		t.Fatal(err)
+	}
+	return list
+}
+
+func getBit(bm []uint64, i int) bool {
+	return i>>6 < len(bm) && bm[i>>6]&(1<<uint(i&63)) != 0
+}
+
+// decode the keys of a domain set, nodes of the trie are numbered in breadth
+// first order and each of them lists its child labels as 0 bits ended by a 1 bit
+func readDomainKeys(t *testing.T, r io.Reader) []string {
+	version := make([]byte, 1)
+	if _, err := io.ReadFull(r, version); err != nil || version[0] != 1 {
+		t.Fatalf("unexpected version %v: %v", version, err)
+	}
+	leaves := readSlice[uint64](t, r)
+	labelBitmap := readSlice[uint64](t, r)
+	labels := readSlice[byte](t, r)
+
+	prefixes := []string{""}
+	var keys []string
+	node, label := 0, 0
+	for i := 0; label < len(labels) || node < len(prefixes); i++ {
+		if getBit(labelBitmap, i) {
+			if getBit(leaves, node) {
+				keys = append(keys, reverse(prefixes[node]))
+			}
+			node++
+			continue
+		}
+		prefixes = append(prefixes, prefixes[node]+string(labels[label]))
+		label++
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestWriteDomain(t *testing.T) {
+	tests := []struct {
+		domain       []string
+		domainSuffix []string
+		want         []string
+	}{
+		{[]string{"example.com"}, nil, []string{"example.com"}},
+		{nil, []string{"example.com"}, []string{"+.example.com", "example.com"}},
+		{nil, []string{".example.com"}, []string{"+.example.com"}},
+		{
+			[]string{"WWW.Google.com", "a.b.c"},
+			[]string{"google.com", ".cn", "googleapis.com."},
+			[]string{"+.cn", "+.google.com", "+.googleapis.com", "a.b.c", "google.com", "googleapis.com", "www.google.com"},
+		},
+		{[]string{"a..com", "bad domain"}, []string{"ok.com"}, []string{"+.ok.com", "ok.com"}},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		if err := WriteDomain(&buf, tt.domain, tt.domainSuffix); err != nil {
+			t.Errorf("%v %v: %v", tt.domain, tt.domainSuffix, err)
+			continue
+		}
+		r := readHeader(t, buf.Bytes(), BehaviorDomain, len(tt.domain)+len(tt.domainSuffix))
+		if keys := readDomainKeys(t, r); !reflect.DeepEqual(keys, tt.want) {
+			t.Errorf("%v %v: expected %v, got %v", tt.domain, tt.domainSuffix, tt.want, keys)
+		}
+	}
+	if err := WriteDomain(io.Discard, nil, []string{".."}); err == nil {
+		t.Error("expected an error for an empty domain set")
+	}
+}
+
+func TestWriteIPCIDR(t *testing.T) {
+	tests := []struct {
+		cidr []string
+		want []string // ranges with ipv4 unmapped
+	}{
+		{[]string{"1.0.0.0/24"}, []string{"1.0.0.0-1.0.0.255"}},
+		{[]string{"1.0.1.0/24", "1.0.0.0/24", "8.8.8.8"}, []string{"1.0.0.0-1.0.1.255", "8.8.8.8-8.8.8.8"}},
+		{[]string{"2001:db8::/32", "10.0.0.0/8", "10.1.0.0/16"}, []string{"10.0.0.0-10.255.255.255", "2001:db8::-2001:db8:ffff:ffff:ffff:ffff:ffff:ffff"}},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		if err := WriteIPCIDR(&buf, tt.cidr); err != nil {
+			t.Errorf("%v: %v", tt.cidr, err)
+			continue
+		}
+		r := readHeader(t, buf.Bytes(), BehaviorIPCIDR, len(tt.cidr))
+		var version byte
+		if err := binary.Read(r, binary.BigEndian, &version); err != nil || version != 1 {
+			t.Fatalf("unexpected version %d: %v", version, err)
+		}
+		var count int64
+		if err := binary.Read(r, binary.BigEndian, &count); err != nil {
+			t.Fatal(err)
+		}
+		var ranges []string
+		for i := int64(0); i < count; i++ {
+			var from, to [16]byte
+			if err := binary.Read(r, binary.BigEndian, &from); err != nil {
+				t.Fatal(err)
+			}
+			if err := binary.Read(r, binary.BigEndian, &to); err != nil {
+				t.Fatal(err)
+			}
+			ipRange := netipx.IPRangeFrom(netip.AddrFrom16(from).Unmap(), netip.AddrFrom16(to).Unmap())
+			ranges = append(ranges, ipRange.String())
+		}
+		if !reflect.DeepEqual(ranges, tt.want) {
+			t.Errorf("%v: expected %v, got %v", tt.cidr, tt.want, ranges)
+		}
+	}
+	if err := WriteIPCIDR(io.Discard, []string{"not an ip"}); err == nil {
+		t.Error("expected an error for an invalid cidr")
+	}
+}
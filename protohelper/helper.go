@@ -71,6 +71,9 @@ func FindCodeByReader(data io.ReadSeeker, code []byte) []byte {
 			return nil
 		}
 		size := header[1]
+		if bodyL < 2+int(size) {
+			return nil
+		}
 		if int(size) == codeL {
 			c := make([]byte, size)
 			_, err = io.ReadFull(data, c)
@@ -116,6 +119,9 @@ func CodeListByReader(data io.ReadSeeker) (list map[string]CodeIndex) {
 			return
 		}
 		size := header[1]
+		if bodyL < 2+int(size) {
+			return // not a list of codes, seeking back would never end
+		}
 		if size > 0 {
 			code := make([]byte, size)
 			_, err = io.ReadFull(tracked, code)
@@ -128,7 +134,6 @@ func CodeListByReader(data io.ReadSeeker) (list map[string]CodeIndex) {
 		// log.Println(bodyL, size)
 		tracked.Seek(int64(bodyL-2-int(size)), io.SeekCurrent)
 	}
-	return
 }
 
 func CodeList(data []byte) (list [][]byte) {
@@ -156,7 +161,6 @@ func CodeList(data []byte) (list [][]byte) {
 		}
 		data = data[bodyL:]
 	}
-	return
 }
 
 func decodeVarint(buf []byte) (x uint64, n int) {
@@ -176,3 +180,21 @@ func decodeVarint(buf []byte) (x uint64, n int) {
 	// The number is too large to represent in a 64-bit value.
 	return 0, 0
 }
+
+// read an entry listed by CodeListByReader, indexes out of the data are
+// rejected since random files can be parsed into garbage indexes
+func ReadEntry(data io.ReadSeeker, index CodeIndex) ([]byte, error) {
+	end, err := data.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	if index.Offset < 0 || index.Size < 0 || index.Offset+index.Size > end {
+		return nil, io.ErrUnexpectedEOF
+	}
+	data.Seek(index.Offset, io.SeekStart)
+	entry := make([]byte, index.Size)
+	if _, err := io.ReadFull(data, entry); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
@@ -0,0 +1,123 @@
+// line based rule-lists of proxy apps, one rule per line in the form of "TYPE,value[,policy][,options]"
+package rulelist
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/snowie2000/geoview/geosite"
+)
+
+// Template holds the rule prefixes of a proxy app, rules with an empty prefix
+// can't be expressed by the app and are skipped
+type Template struct {
+	Domain        string
+	DomainSuffix  string
+	DomainKeyword string
+	DomainRegex   string
+	IPCIDR        string
+	IPCIDR6       string
+	// policy appended after the value, rule-sets referenced by a config usually have none
+	Policy string
+	// options appended to every rule
+	Options []string
+	// options appended to ip rules only, e.g. "no-resolve"
+	IPOptions []string
+	// separator of the fields of ip rules, "," if empty
+	IPSeparator string
+}
+
+var templates = map[string]Template{
+	"quantumultx": {
+		Domain:        "host",
+		DomainSuffix:  "host-suffix",
+		DomainKeyword: "host-keyword",
+		IPCIDR:        "ip-cidr",
+		IPCIDR6:       "ip6-cidr",
+		Policy:        "Proxy",
+		IPSeparator:   ", ",
+	},
+	"surge": {
+		Domain:        "DOMAIN",
+		DomainSuffix:  "DOMAIN-SUFFIX",
+		DomainKeyword: "DOMAIN-KEYWORD",
+		IPCIDR:        "IP-CIDR",
+		IPCIDR6:       "IP-CIDR6",
+		IPOptions:     []string{"no-resolve"},
+	},
+}
+
+var alias = map[string]string{
+	"qx": "quantumultx",
+	// loon and shadowrocket share the rule names of surge
+	"loon":         "surge",
+	"shadowrocket": "surge",
+}
+
+// get a copy of the template of a proxy app, so it can be customized freely
+func Get(name string) (*Template, error) {
+	name = strings.ToLower(name)
+	if v, ok := alias[name]; ok {
+		name = v
+	}
+	t, ok := templates[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown rule-list format: %s", name)
+	}
+	t.Options = append([]string(nil), t.Options...)
+	t.IPOptions = append([]string(nil), t.IPOptions...)
+	return &t, nil
+}
+
+// compose a rule line, empty fields are omitted
+func (t *Template) rule(sep string, prefix string, value string, options ...[]string) string {
+	fields := []string{prefix, value}
+	if t.Policy != "" {
+		fields = append(fields, t.Policy)
+	}
+	for _, opts := range options {
+		fields = append(fields, opts...)
+	}
+	return strings.Join(fields, sep)
+}
+
+// convert geosite items into rules
+func (t *Template) FromItems(itemlist []geosite.Item) []string {
+	list := []string{}
+	for _, it := range itemlist {
+		var prefix string
+		switch it.Type {
+		case geosite.RuleTypeDomain:
+			prefix = t.Domain
+		case geosite.RuleTypeDomainSuffix:
+			prefix = t.DomainSuffix
+		case geosite.RuleTypeDomainKeyword:
+			prefix = t.DomainKeyword
+		case geosite.RuleTypeDomainRegex:
+			prefix = t.DomainRegex
+		}
+		if prefix != "" {
+			list = append(list, t.rule(",", prefix, it.Value, t.Options))
+		}
+	}
+	return list
+}
+
+// convert ip-cidr into rules
+func (t *Template) FromCIDR(cidrList []string) []string {
+	sep := t.IPSeparator
+	if sep == "" {
+		sep = ","
+	}
+	list := make([]string, 0, len(cidrList))
+	for _, cidr := range cidrList {
+		prefix := t.IPCIDR
+		if strings.Contains(cidr, ":") {
+			prefix = t.IPCIDR6
+		}
+		if prefix != "" {
+			list = append(list, t.rule(sep, prefix, cidr, t.IPOptions, t.Options))
+		}
+	}
+	return list
+}
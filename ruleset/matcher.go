@@ -0,0 +1,284 @@
+package ruleset
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"regexp"
+	"strings"
+
+	"github.com/sagernet/sing/common/domain"
+	"github.com/snowie2000/geoview/srs"
+	"go4.org/netipx"
+)
+
+// Matcher evaluates the rules of a rule-set in the same way as sing-box, so
+// that a batch of ips and domains can be looked up without reading the file again
+type Matcher struct {
+	rules []*ruleMatcher
+}
+
+// Match is a rule which matched the lookup target, Path is the position of the
+// rule in the rule-set, e.g. "rules[2].rules[0]" for a rule of a logical rule
+type Match struct {
+	Path string
+	Rule string
+}
+
+type ruleMatcher struct {
+	path   string
+	invert bool
+
+	// default rule
+	rule    *srs.DefaultHeadlessRule
+	domains *domain.Matcher
+	regexes []*regexp.Regexp
+	ipSet   *netipx.IPSet
+	// items such as port and process can't be matched by a single ip or domain
+	unmatchable bool
+
+	// logical rule
+	logical bool
+	and     bool
+	rules   []*ruleMatcher
+}
+
+func newRuleMatcher(rule srs.HeadlessRule, path string) (*ruleMatcher, error) {
+	switch rule.Type {
+	case srs.RuleTypeDefault, "":
+		return newDefaultMatcher(rule.DefaultOptions, path)
+	case srs.RuleTypeLogical:
+		m := &ruleMatcher{
+			path:    path,
+			invert:  rule.LogicalOptions.Invert,
+			logical: true,
+			and:     rule.LogicalOptions.Mode == srs.LogicalTypeAnd,
+		}
+		for i, sub := range rule.LogicalOptions.Rules {
+			subMatcher, err := newRuleMatcher(sub, fmt.Sprintf("%s.rules[%d]", path, i))
+			if err != nil {
+				return nil, err
+			}
+			m.rules = append(m.rules, subMatcher)
+		}
+		return m, nil
+	}
+	return nil, fmt.Errorf("unknown rule type: %s", rule.Type)
+}
+
+// lowercased copies of the values, targets are lowercased before matching
+func lowerValues(values []string) []string {
+	if values == nil {
+		return nil
+	}
+	list := make([]string, len(values))
+	for i, v := range values {
+		list[i] = strings.ToLower(v)
+	}
+	return list
+}
+
+func newDefaultMatcher(rule srs.DefaultHeadlessRule, path string) (*ruleMatcher, error) {
+	rule.Domain = lowerValues(rule.Domain)
+	rule.DomainSuffix = lowerValues(rule.DomainSuffix)
+	rule.DomainKeyword = lowerValues(rule.DomainKeyword)
+	m := &ruleMatcher{
+		path:   path,
+		invert: rule.Invert,
+		rule:   &rule,
+	}
+	if len(rule.Domain) > 0 || len(rule.DomainSuffix) > 0 {
+		m.domains = domain.NewMatcher(rule.Domain, rule.DomainSuffix, false)
+	}
+	for _, v := range rule.DomainRegex {
+		re, err := regexp.Compile(v)
+		if err != nil {
+			return nil, err
+		}
+		m.regexes = append(m.regexes, re)
+	}
+	if len(rule.IPCIDR) > 0 {
+		var builder netipx.IPSetBuilder
+		for _, cidr := range rule.IPCIDR {
+			prefix, err := parsePrefix(cidr)
+			if err != nil {
+				return nil, err
+			}
+			builder.AddPrefix(prefix)
+		}
+		ipSet, err := builder.IPSet()
+		if err != nil {
+			return nil, err
+		}
+		m.ipSet = ipSet
+	}
+
+	// anything left after removing the destination items can't be satisfied
+	other := rule
+	other.Domain, other.DomainSuffix, other.DomainKeyword, other.DomainRegex, other.IPCIDR = nil, nil, nil, nil, nil
+	other.DomainMatcher, other.IPSet = nil, nil
+	m.unmatchable = other.IsValid()
+	return m, nil
+}
+
+// a cidr or a single ip address
+func parsePrefix(cidr string) (netip.Prefix, error) {
+	if prefix, err := netip.ParsePrefix(cidr); err == nil {
+		return prefix.Masked(), nil
+	}
+	addr, err := netip.ParseAddr(cidr)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	return netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()), nil
+}
+
+// destination items are matched if any of them matches, as sing-box does
+func (m *ruleMatcher) matchItems(addr netip.Addr, target string) bool {
+	if m.unmatchable {
+		return false
+	}
+	if addr.IsValid() {
+		return m.ipSet != nil && m.ipSet.Contains(addr)
+	}
+	if m.domains != nil && m.domains.Match(target) {
+		return true
+	}
+	for _, keyword := range m.rule.DomainKeyword {
+		if strings.Contains(target, keyword) {
+			return true
+		}
+	}
+	for _, re := range m.regexes {
+		if re.MatchString(target) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *ruleMatcher) match(addr netip.Addr, target string) bool {
+	if !m.logical {
+		return m.matchItems(addr, target) != m.invert
+	}
+	matched := m.and
+	for _, sub := range m.rules {
+		if sub.match(addr, target) != m.and {
+			matched = !m.and
+			break
+		}
+	}
+	return matched != m.invert
+}
+
+// the items of a matched rule which contain the target, an inverted rule is
+// explained by itself as none of its items matched
+func (m *ruleMatcher) explain(addr netip.Addr, target string) []Match {
+	if !m.match(addr, target) {
+		return nil
+	}
+	if m.invert {
+		return []Match{{Path: m.path, Rule: "invert"}}
+	}
+	var list []Match
+	if m.logical {
+		for _, sub := range m.rules {
+			list = append(list, sub.explain(addr, target)...)
+		}
+		return list
+	}
+	if addr.IsValid() {
+		for _, cidr := range m.rule.IPCIDR {
+			if prefix, err := parsePrefix(cidr); err == nil && prefix.Contains(addr) {
+				list = append(list, Match{Path: m.path, Rule: CodeIPCIDR + ":" + cidr})
+			}
+		}
+		return list
+	}
+	for _, v := range m.rule.Domain {
+		if target == v {
+			list = append(list, Match{Path: m.path, Rule: CodeDomain + ":" + v})
+		}
+	}
+	for _, v := range m.rule.DomainSuffix {
+		// a suffix starting with "." doesn't match the domain itself
+		if strings.HasSuffix(target, v) && (strings.HasPrefix(v, ".") || target == v || strings.HasSuffix(target, "."+v)) {
+			list = append(list, Match{Path: m.path, Rule: CodeDomainSuffix + ":" + v})
+		}
+	}
+	for _, v := range m.rule.DomainKeyword {
+		if strings.Contains(target, v) {
+			list = append(list, Match{Path: m.path, Rule: CodeDomainKeyword + ":" + v})
+		}
+	}
+	for i, re := range m.regexes {
+		if re.MatchString(target) {
+			list = append(list, Match{Path: m.path, Rule: CodeDomainRegex + ":" + m.rule.DomainRegex[i]})
+		}
+	}
+	return list
+}
+
+func (r *RuleSetIn) NewMatcher() (*Matcher, error) {
+	ruleset, err := r.load()
+	if err != nil {
+		return nil, err
+	}
+	m := new(Matcher)
+	for i, rule := range ruleset.Options.Rules {
+		ruleMatcher, err := newRuleMatcher(rule, fmt.Sprintf("rules[%d]", i))
+		if err != nil {
+			return nil, err
+		}
+		m.rules = append(m.rules, ruleMatcher)
+	}
+	return m, nil
+}
+
+func parseTarget(target string) (netip.Addr, string) {
+	target = strings.TrimSpace(target)
+	if ip := net.ParseIP(target); ip != nil {
+		addr, _ := netip.AddrFromSlice(ip)
+		return addr.Unmap(), target
+	}
+	return netip.Addr{}, strings.ToLower(target)
+}
+
+// return the item types matching an ip or domain, e.g. "domain_suffix", and
+// "invert" if an inverted rule matched. matched rules are shown by Explain
+func (m *Matcher) Match(target string) []string {
+	matched := make(map[string]bool)
+	for _, match := range m.Explain(target) {
+		code, _, _ := strings.Cut(match.Rule, ":")
+		matched[code] = true
+	}
+	matchedList := []string{}
+	for _, code := range allCodes {
+		if matched[code] {
+			matchedList = append(matchedList, code)
+		}
+	}
+	if matched["invert"] {
+		matchedList = append(matchedList, "invert")
+	}
+	return matchedList
+}
+
+// return the rules and items matching an ip or domain
+func (m *Matcher) Explain(target string) []Match {
+	addr, target := parseTarget(target)
+	list := []Match{}
+	for _, rule := range m.rules {
+		list = append(list, rule.explain(addr, target)...)
+	}
+	return list
+}
+
+// search for an ip or domain in the rule-set and return matched item types
+func (r *RuleSetIn) Lookup(target string) ([]string, error) {
+	m, err := r.NewMatcher()
+	if err != nil {
+		return nil, err
+	}
+	return m.Match(target), nil
+}
@@ -0,0 +1,324 @@
+package ruleset
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/sagernet/sing/common"
+	"github.com/snowie2000/geoview/geoip"
+	"github.com/snowie2000/geoview/geosite"
+	"github.com/snowie2000/geoview/protohelper"
+	"github.com/snowie2000/geoview/rulelist"
+	"github.com/snowie2000/geoview/srs"
+)
+
+// a rule-set has no codes, the item types it contains are used as codes instead
+const (
+	CodeDomain        = "domain"
+	CodeDomainSuffix  = "domain_suffix"
+	CodeDomainKeyword = "domain_keyword"
+	CodeDomainRegex   = "domain_regex"
+	CodeIPCIDR        = "ip_cidr"
+)
+
+var allCodes = []string{CodeDomain, CodeDomainSuffix, CodeDomainKeyword, CodeDomainRegex, CodeIPCIDR}
+
+type RuleSetIn struct {
+	URI       string
+	Want      map[string]bool
+	MustExist bool
+	// Reader is read instead of the file of URI if set, Size is its length
+	Reader io.ReaderAt
+	Size   int64
+}
+
+// open the rule-set file, or the reader if set
+func (r *RuleSetIn) open() (io.ReadSeekCloser, error) {
+	if r.Reader != nil {
+		return &protohelper.NopReadSeekCloser{ReadSeeker: io.NewSectionReader(r.Reader, 0, r.Size)}, nil
+	}
+	return os.Open(r.URI)
+}
+
+// load the sing-box rule-set, both binary and source(json) formats are accepted
+func (r *RuleSetIn) load() (*srs.PlainRuleSetCompat, error) {
+	file, err := r.open()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	ruleset, err := srs.Read(file, true)
+	if err == nil {
+		return &ruleset, nil
+	}
+	// not a binary rule-set, try json source
+	file.Seek(0, io.SeekStart)
+	content, jsonErr := io.ReadAll(file)
+	if jsonErr != nil {
+		return nil, jsonErr
+	}
+	plain, jsonErr := decodeJSONRuleSet(content)
+	if jsonErr != nil {
+		return nil, fmt.Errorf("Not a valid rule-set format: %s", err.Error())
+	}
+	return plain, nil
+}
+
+// decode a json source rule-set, a version and a list of rules are required so
+// that any other json is not taken as an empty rule-set
+func decodeJSONRuleSet(content []byte) (*srs.PlainRuleSetCompat, error) {
+	var header struct {
+		Version *json.RawMessage  `json:"version"`
+		Rules   []json.RawMessage `json:"rules"`
+	}
+	if err := json.Unmarshal(content, &header); err != nil {
+		return nil, err
+	}
+	if header.Version == nil || header.Rules == nil {
+		return nil, errors.New("version or rules is missing")
+	}
+	var plain srs.PlainRuleSetCompat
+	if err := json.Unmarshal(content, &plain); err != nil {
+		return nil, err
+	}
+	return &plain, nil
+}
+
+// report whether the file is a sing-box rule-set
+func IsRuleSet(path string) bool {
+	_, err := (&RuleSetIn{URI: path}).load()
+	return err == nil
+}
+
+// read all rules of the rule-set and flatten them into a single rule
+func (r *RuleSetIn) flatten() (*srs.DefaultHeadlessRule, error) {
+	ruleset, err := r.load()
+	if err != nil {
+		return nil, err
+	}
+	rule := new(srs.DefaultHeadlessRule)
+	collect(ruleset.Options.Rules, rule)
+	return rule, nil
+}
+
+// inverted rules and "and" rules can't be represented by a plain list, they are skipped
+func collect(rules []srs.HeadlessRule, dst *srs.DefaultHeadlessRule) {
+	for _, rule := range rules {
+		switch rule.Type {
+		case srs.RuleTypeDefault, "":
+			if rule.DefaultOptions.Invert {
+				continue
+			}
+			dst.Domain = append(dst.Domain, rule.DefaultOptions.Domain...)
+			dst.DomainSuffix = append(dst.DomainSuffix, rule.DefaultOptions.DomainSuffix...)
+			dst.DomainKeyword = append(dst.DomainKeyword, rule.DefaultOptions.DomainKeyword...)
+			dst.DomainRegex = append(dst.DomainRegex, rule.DefaultOptions.DomainRegex...)
+			dst.IPCIDR = append(dst.IPCIDR, rule.DefaultOptions.IPCIDR...)
+		case srs.RuleTypeLogical:
+			if rule.LogicalOptions.Invert || rule.LogicalOptions.Mode != srs.LogicalTypeOr {
+				continue
+			}
+			collect(rule.LogicalOptions.Rules, dst)
+		}
+	}
+}
+
+func valuesOf(rule *srs.DefaultHeadlessRule, code string) []string {
+	switch code {
+	case CodeDomain:
+		return rule.Domain
+	case CodeDomainSuffix:
+		return rule.DomainSuffix
+	case CodeDomainKeyword:
+		return rule.DomainKeyword
+	case CodeDomainRegex:
+		return rule.DomainRegex
+	case CodeIPCIDR:
+		return rule.IPCIDR
+	}
+	return nil
+}
+
+// keep only the wanted item types and ip versions
+func (r *RuleSetIn) filter(rule *srs.DefaultHeadlessRule, ipType geoip.IPType) (*srs.DefaultHeadlessRule, error) {
+	for code := range r.Want {
+		values := valuesOf(rule, code)
+		if len(values) == 0 && r.MustExist {
+			return nil, fmt.Errorf("%s doesn't exist", code)
+		}
+	}
+	filtered := new(srs.DefaultHeadlessRule)
+	if r.Want[CodeDomain] {
+		filtered.Domain = common.Uniq(rule.Domain)
+	}
+	if r.Want[CodeDomainSuffix] {
+		filtered.DomainSuffix = common.Uniq(rule.DomainSuffix)
+	}
+	if r.Want[CodeDomainKeyword] {
+		filtered.DomainKeyword = common.Uniq(rule.DomainKeyword)
+	}
+	if r.Want[CodeDomainRegex] {
+		filtered.DomainRegex = common.Uniq(rule.DomainRegex)
+	}
+	if r.Want[CodeIPCIDR] {
+		for _, cidr := range common.Uniq(rule.IPCIDR) {
+			if strings.Contains(cidr, ":") {
+				if ipType&geoip.IPv6 != 0 {
+					filtered.IPCIDR = append(filtered.IPCIDR, cidr)
+				}
+			} else if ipType&geoip.IPv4 != 0 {
+				filtered.IPCIDR = append(filtered.IPCIDR, cidr)
+			}
+		}
+	}
+	return filtered, nil
+}
+
+func (r *RuleSetIn) extract(ipType geoip.IPType) (*srs.DefaultHeadlessRule, error) {
+	rule, err := r.flatten()
+	if err != nil {
+		return nil, err
+	}
+	return r.filter(rule, ipType)
+}
+
+// convert the domain rules into geosite items
+func toItems(rule *srs.DefaultHeadlessRule) []geosite.Item {
+	var items []geosite.Item
+	for _, v := range rule.Domain {
+		items = append(items, geosite.Item{Type: geosite.RuleTypeDomain, Value: v})
+	}
+	for _, v := range rule.DomainSuffix {
+		// remove "." prefix for singbox rules
+		items = append(items, geosite.Item{Type: geosite.RuleTypeDomainSuffix, Value: strings.TrimPrefix(v, ".")})
+	}
+	for _, v := range rule.DomainKeyword {
+		items = append(items, geosite.Item{Type: geosite.RuleTypeDomainKeyword, Value: v})
+	}
+	for _, v := range rule.DomainRegex {
+		items = append(items, geosite.Item{Type: geosite.RuleTypeDomainRegex, Value: v})
+	}
+	return items
+}
+
+// the rule-set file name is used as the code when converting to geosite or geoip
+func (r *RuleSetIn) name() string {
+	base := filepath.Base(r.URI)
+	return strings.ToUpper(strings.TrimSuffix(base, filepath.Ext(base)))
+}
+
+// list item types stored in the rule-set
+func (r *RuleSetIn) Codes() ([]string, error) {
+	rule, err := r.flatten()
+	if err != nil {
+		return nil, err
+	}
+	var list []string
+	for _, code := range allCodes {
+		if len(valuesOf(rule, code)) > 0 {
+			list = append(list, code)
+		}
+	}
+	return list, nil
+}
+
+func (r *RuleSetIn) Extract(ipType geoip.IPType) ([]string, error) {
+	rule, err := r.extract(ipType)
+	if err != nil {
+		return nil, err
+	}
+	var domains []string
+	for _, it := range toItems(rule) {
+		domains = append(domains, it.Value)
+	}
+	domains = common.Uniq(domains)
+	sort.Strings(domains)
+	list := append(domains, rule.IPCIDR...)
+	if len(list) == 0 {
+		return nil, fmt.Errorf("no match item found")
+	}
+	return list, nil
+}
+
+func (r *RuleSetIn) ToRuleSet(ipType geoip.IPType) (*srs.PlainRuleSetCompat, error) {
+	rule, err := r.extract(ipType)
+	if err != nil {
+		return nil, err
+	}
+	if !rule.IsValid() {
+		return nil, fmt.Errorf("empty rule set")
+	}
+	ruleset := &srs.PlainRuleSetCompat{
+		Version: srs.RuleSetVersionCurrent,
+	}
+	ruleset.Options.Rules = []srs.HeadlessRule{{
+		Type:           srs.RuleTypeDefault,
+		DefaultOptions: *rule,
+	}}
+	return ruleset, nil
+}
+
+func (r *RuleSetIn) ToClash(ipType geoip.IPType, behavior string) ([]string, error) {
+	rule, err := r.extract(ipType)
+	if err != nil {
+		return nil, err
+	}
+	list, err := geosite.ItemToClashRule(toItems(rule), behavior)
+	if err != nil {
+		return nil, err
+	}
+	ipList, err := geoip.CIDRToClashRule(rule.IPCIDR, behavior)
+	if err != nil {
+		return nil, err
+	}
+	return append(list, ipList...), nil
+}
+
+func (r *RuleSetIn) ToRuleList(ipType geoip.IPType, template *rulelist.Template) ([]string, error) {
+	rule, err := r.extract(ipType)
+	if err != nil {
+		return nil, err
+	}
+	return append(template.FromItems(toItems(rule)), template.FromCIDR(rule.IPCIDR)...), nil
+}
+
+func (r *RuleSetIn) ToGeosite() (*geosite.GeoSiteList, error) {
+	rule, err := r.extract(0)
+	if err != nil {
+		return nil, err
+	}
+	items := toItems(rule)
+	if len(items) == 0 {
+		return nil, fmt.Errorf("empty domain set")
+	}
+	return &geosite.GeoSiteList{
+		Entry: []*geosite.GeoSite{{
+			CountryCode: r.name(),
+			Domain:      geosite.SingItemToV2(items),
+		}},
+	}, nil
+}
+
+func (r *RuleSetIn) ToGeoIP(ipType geoip.IPType) (*geoip.GeoIPList, error) {
+	rule, err := r.extract(ipType)
+	if err != nil {
+		return nil, err
+	}
+	if len(rule.IPCIDR) == 0 {
+		return nil, fmt.Errorf("empty ip set")
+	}
+	entry, err := geoip.CIDRToGeoIP(r.name(), rule.IPCIDR)
+	if err != nil {
+		return nil, err
+	}
+	return &geoip.GeoIPList{
+		Entry: []*geoip.GeoIP{entry},
+	}, nil
+}